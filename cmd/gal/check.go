@@ -0,0 +1,26 @@
+package main
+
+import (
+	"gssh/core"
+	"os"
+	"strconv"
+)
+
+// 检查配置文件
+func check(app *core.App) {
+	problems, err := app.Check()
+	if err != nil {
+		core.Errorln("读取配置文件失败：", err)
+		os.Exit(1)
+	}
+	if len(problems) == 0 {
+		core.Infoln("配置文件检查通过：", app.ConfigPath)
+		os.Exit(0)
+	}
+
+	for _, p := range problems {
+		core.Errorln(p)
+	}
+	core.Errorln("共发现" + strconv.Itoa(len(problems)) + "个问题")
+	os.Exit(1)
+}
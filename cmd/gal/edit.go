@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"gssh/core"
+	"gssh/core/scp"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 用本地编辑器修改远程文件：gal edit [-touch] 服务器:路径
+// 下载到临时文件，编辑器退出后如果有修改则上传，远程文件在编辑期间被修改时不上传
+func editCmd(app *core.App, args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	touch := fs.Bool("touch", false, "上传时使用保存时间作为修改时间，默认保留原来的修改时间")
+	fs.Parse(args)
+	i := strings.Index(fs.Arg(0), ":")
+	if fs.NArg() != 1 || i <= 0 || i == len(fs.Arg(0))-1 {
+		fmt.Println("gal edit [-touch] 服务器:路径")
+		os.Exit(2)
+	}
+	server, err := app.GetServer(fs.Arg(0)[:i])
+	exitOnError(err)
+
+	e := &remoteEdit{server: server, path: fs.Arg(0)[i+1:], touch: *touch}
+	if err := e.run(); err != nil {
+		core.Errorln("编辑失败：", err)
+		os.Exit(1)
+	}
+}
+
+type remoteEdit struct {
+	server *core.Server
+	path   string
+	touch  bool
+
+	// 下载时的远程文件信息和内容摘要
+	info    *scp.FileInfo
+	size    int64
+	modTime time.Time
+	sum     [sha256.Size]byte
+}
+
+func (e *remoteEdit) run() error {
+	dir, err := ioutil.TempDir("", "gal-edit")
+	if err != nil {
+		return err
+	}
+	local := filepath.Join(dir, path.Base(e.path))
+	keep := false
+	defer func() {
+		if !keep {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	data, err := e.download()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(local, data, 0600); err != nil {
+		return err
+	}
+
+	if err := runEditor(local); err != nil {
+		return err
+	}
+	edited, err := ioutil.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(edited) == e.sum {
+		core.Infoln("文件没有修改")
+		return nil
+	}
+
+	// 编辑可能需要很长时间，上传时重新连接
+	if err := e.upload(edited); err != nil {
+		keep = true
+		return fmt.Errorf("%v，修改后的文件保存在 %s", err, local)
+	}
+	core.Infoln("已保存：" + e.server.Name + ":" + e.path)
+	return nil
+}
+
+// 下载远程文件，记录权限、时间和摘要
+func (e *remoteEdit) download() ([]byte, error) {
+	client, err := e.server.Dial(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	fi, err := client.FS().Stat(e.path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, errors.New("不是普通文件：" + e.path)
+	}
+	e.path = fi.Path
+
+	var buf bytes.Buffer
+	s := scp.NewSCP(client.Client)
+	e.info, err = s.Receive(e.path, &buf)
+	core.AuditTransfer(e.server, "download", e.path, "edit", s.Transferred(), err)
+	if err != nil {
+		return nil, err
+	}
+	e.size, e.modTime = fi.Size(), fi.ModTime()
+	e.sum = sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// 确认远程文件没有变化后上传，保留原来的权限
+func (e *remoteEdit) upload(data []byte) error {
+	client, err := e.server.Dial(context.Background())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := e.checkUnchanged(client); err != nil {
+		return err
+	}
+
+	modTime, accessTime := e.info.ModTime(), e.info.AccessTime()
+	if e.touch {
+		modTime, accessTime = time.Now(), time.Now()
+	}
+	info := scp.NewFileInfo(e.path, int64(len(data)), e.info.Mode(), modTime, accessTime)
+	s := scp.NewSCP(client.Client)
+	err = s.Send(info, ioutil.NopCloser(bytes.NewReader(data)), e.path)
+	core.AuditTransfer(e.server, "upload", "edit", e.path, s.Transferred(), err)
+	return err
+}
+
+// 比较修改时间、大小和内容摘要，判断远程文件在编辑期间是否被修改
+func (e *remoteEdit) checkUnchanged(client *core.Client) error {
+	changed := errors.New("远程文件在编辑期间已被修改，没有上传")
+	fi, err := client.FS().Stat(e.path)
+	if err != nil {
+		return err
+	}
+	if !fi.ModTime().Equal(e.modTime) || fi.Size() != e.size {
+		return changed
+	}
+	h := sha256.New()
+	s := scp.NewSCP(client.Client)
+	if _, err := s.Receive(e.path, h); err != nil {
+		return err
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	if sum != e.sum {
+		return changed
+	}
+	return nil
+}
+
+// 使用$VISUAL或$EDITOR编辑文件，默认vi
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := osexec.Command(args[0], append(args[1:], file)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Ctrl-C交给编辑器处理
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("编辑器 %s 执行错误：%v", editor, err)
+	}
+	return nil
+}
@@ -21,37 +21,62 @@ var (
 	config = flag.String("c", "", "配置文件，默认al.conf")
 	en     = flag.String("e", "", "加密密码")
 	de     = flag.String("x", "", "licl")
-	down   = flag.String("d", "", "下载配置文件")
-	up     = flag.String("u", "", "下载配置文件")
+	down   = flag.String("d", "", "下载配置文件，服务器名[:路径] 或 本地目录")
+	up     = flag.String("u", "", "上传配置文件，服务器名[:路径] 或 本地目录")
+	line   = flag.Bool("l", false, "使用行模式菜单")
+	sel    = flag.String("s", "", "按标签过滤菜单，例如：role=db,env!=prod")
+	exec   = flag.String("exec", "", "登录后在终端中执行的命令，执行完进入shell")
+
+	// 菜单只显示满足条件的服务
+	selector *core.Selector
 )
 
 func main() {
 	cmdParse()
 	version()
 
-	downConfig()
-	upConfig()
-
-	upConfig()
 	encrypt()
 	defer func() {
 		if err := recover(); err != nil {
 			core.Log.Error("recover", err)
 		}
 	}()
-	configFile := core.ReadConfigPath(*config)
+	// 回放录像不需要配置文件
+	if flag.Arg(0) == "replay" {
+		replayCmd(flag.Args()[1:])
+		return
+	}
+	configFile, err := core.ReadConfigPath(*config)
+	exitOnError(err)
 
 	app := core.App{
 		ConfigPath: configFile,
 	}
+	selector, err = core.ParseSelector(*sel)
+	exitOnError(err)
 	decrypt(&app)
+	downConfig(&app)
+	upConfig(&app)
 
-	serverName := ""
-	if len(os.Args) > 1 {
-		serverName = os.Args[1]
+	serverName := flag.Arg(0)
+	switch serverName {
+	case "check":
+		check(&app)
+	case "server":
+		serverCmd(&app, flag.Args()[1:])
+		return
+	case "group":
+		groupCmd(&app, flag.Args()[1:])
+		return
+	case "ls":
+		lsCmd(&app, flag.Args()[1:])
+		return
+	case "edit":
+		editCmd(&app, flag.Args()[1:])
+		return
 	}
 	core.Log.Info("登录服务器: ", serverName)
-	app.Init(serverName)
+	run(&app, serverName)
 }
 
 func cmdParse() {
@@ -70,22 +95,43 @@ func version() {
 	}
 }
 
-func downConfig() {
+func downConfig(app *core.App) {
 	if *down != "" {
-		//下载配置文件，暂时未实现
-		fmt.Println("下载配置文件，功能稍后开放")
+		target, err := core.NewSyncTarget(app, *down)
+		if err == nil {
+			target.Notify = notify
+			core.Infoln("下载配置文件：", target)
+			err = target.Download()
+		}
+		if err != nil {
+			core.Errorln("下载配置文件失败：", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 }
 
-func upConfig() {
+func upConfig(app *core.App) {
 	if *up != "" {
-		//上传配置文件，暂时未实现
-		fmt.Println("上传配置文件，功能稍后开放")
+		target, err := core.NewSyncTarget(app, *up)
+		if err == nil {
+			target.Notify = notify
+			core.Infoln("上传配置文件：", target)
+			err = target.Upload()
+		}
+		if err != nil {
+			core.Errorln("上传配置文件失败：", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 }
 
+// 输出同步提示
+func notify(msg string) {
+	core.Infoln(msg)
+}
+
 func encrypt() {
 	if *en != "" {
 		fmt.Println(*en)
@@ -101,7 +147,8 @@ func encrypt() {
 func decrypt(app *core.App) {
 	if *de != "" {
 		fmt.Println("主机信息：", *de)
-		d := app.ShowPasswd(*de)
+		d, err := app.ShowPasswd(*de)
+		exitOnError(err)
 		s, err := core.Decrypt(d)
 		if err != nil {
 			fmt.Println("de error: ", err)
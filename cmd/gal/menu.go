@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gssh/core"
+	"gssh/core/tui"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 登录指定的服务，没有指定或服务不存在时显示菜单
+func run(app *core.App, serverName string) {
+	exitOnError(app.Load())
+	if serverName != "" {
+		server, err := app.GetServer(serverName)
+		if err == nil {
+			connect(server)
+			return
+		}
+		if !errors.Is(err, core.ErrServerNotFound) {
+			exitOnError(err)
+		}
+	}
+	show(app)
+}
+
+// 登录服务器，设置了-exec时先执行命令再进入shell
+// 连接意外断开时按AutoReconnect、ReconnectAttempts重新连接
+func connect(server *core.Server) {
+	tipsMsg(server.Name)
+	if *exec != "" {
+		server.MergeOptions(map[string]interface{}{"RemoteCommand": core.ExecThenShell(*exec)}, true)
+	}
+
+	attempts := server.ReconnectAttempts()
+	for retry := 0; ; retry++ {
+		err := server.Connect()
+		if err == nil {
+			return
+		}
+		core.Errorln(err)
+		lost := errors.Is(err, core.ErrConnectionLost)
+		if lost {
+			// 连接成功后断开的，重新计数
+			retry = 0
+		}
+		if !(lost || errors.Is(err, core.ErrHostUnreachable)) || retry >= attempts {
+			os.Exit(1)
+		}
+		delay := time.Duration(retry+1) * 2 * time.Second
+		core.Errorln(fmt.Sprintf("%v后重新连接（%d/%d），Ctrl-C取消", delay, retry+1, attempts))
+		core.Log.Info("reconnect", server.Name, retry+1)
+		time.Sleep(delay)
+	}
+}
+
+func tipsMsg(name string) {
+	core.Infoln("================================")
+	core.Info("您登录的服务器：")
+	core.Errorln(name)
+	core.Infoln("================================")
+}
+
+// 重新加载配置并显示菜单
+func reload(app *core.App) {
+	exitOnError(app.Load())
+	show(app)
+}
+
+func show(app *core.App) {
+	if !*line && tui.IsTerminal() {
+		pick(app)
+		return
+	}
+
+	core.Clear()
+
+	entries, err := app.ListServers(selector)
+	exitOnError(err)
+
+	// 输出server
+	showServers(app, entries)
+
+	// 监听输入
+	input, isGlobal := checkInput(app, entries)
+	if isGlobal {
+		handleGlobalCmd(app, input)
+		return
+	}
+	server, _ := app.ServerByFlag(input)
+	core.Log.Info("select server", server.Name)
+	connect(server)
+}
+
+func handleGlobalCmd(app *core.App, cmd string) {
+	switch strings.ToLower(cmd) {
+	case "exit":
+	case "edit":
+		handleEdit(app)
+	case "add":
+		handleAdd(app)
+	case "remove":
+		handleRemove(app)
+	default:
+		core.Errorln("指令无效")
+	}
+}
+
+// 读取序号，输入exit时返回false
+func readFlag(app *core.App) (*core.Server, bool) {
+	for {
+		core.Info("请输入相应序号（exit退出当前操作）：")
+		id := ""
+		fmt.Scanln(&id)
+
+		if strings.ToLower(id) == "exit" {
+			return nil, false
+		}
+		if server, ok := app.ServerByFlag(id); ok {
+			return server, true
+		}
+		core.Errorln("序号不存在")
+	}
+}
+
+// 编辑
+func handleEdit(app *core.App) {
+	server, ok := readFlag(app)
+	if !ok {
+		show(app)
+		return
+	}
+	editServer(app, server)
+	reload(app)
+}
+
+// 编辑服务，只保存修改过的字段，未修改的字段继续继承分组默认值
+func editServer(app *core.App, server *core.Server) {
+	name := server.Name
+	values := promptServer(server)
+	if len(values) == 0 {
+		return
+	}
+	if err := app.SetServer(name, values); err != nil {
+		core.Errorln("保存失败：", err)
+		waitEnter()
+	}
+}
+
+// 移除
+func handleRemove(app *core.App) {
+	server, ok := readFlag(app)
+	if !ok {
+		show(app)
+		return
+	}
+	if err := app.RemoveServer(server.Name); err != nil {
+		core.Errorln("删除失败：", err)
+		waitEnter()
+	}
+	reload(app)
+}
+
+// 新增
+func handleAdd(app *core.App) {
+	groups, err := app.ListGroups()
+	exitOnError(err)
+	prefixes := make(map[string]bool)
+	for _, g := range groups {
+		prefixes[g.Prefix] = true
+		core.Info("["+g.Prefix+"]"+g.Title, "\t")
+	}
+	core.Infoln("[其他值]默认组")
+	core.Info("请输入要插入的组：")
+	g := ""
+	fmt.Scanln(&g)
+	if !prefixes[g] {
+		g = ""
+	}
+
+	// 只保存输入的字段，端口、method等留空时加载配置时再使用默认值
+	server := core.Server{}
+	promptServer(&server)
+	if server.Password != "" {
+		passwd, err := core.Encrypt(server.Password)
+		exitOnError(err)
+		server.Password = passwd
+	}
+
+	if err := app.AddServer(g, server); err != nil {
+		core.Errorln("添加失败：", err)
+		waitEnter()
+	}
+	reload(app)
+}
+
+// 逐项输入服务字段，直接回车保留原值，返回修改过的字段（密码为明文）
+func promptServer(server *core.Server) map[string]string {
+	values := make(map[string]string)
+	prompt := func(key, title, value string) string {
+		core.Info(title + "(default=" + value + ")：")
+		input := ""
+		fmt.Scanln(&input)
+		if input == "" || input == value {
+			return value
+		}
+		values[key] = input
+		return input
+	}
+
+	server.Name = prompt("name", "Name", server.Name)
+	server.IP = prompt("ip", "Ip", server.IP)
+	port := ""
+	if server.Port != 0 {
+		port = strconv.Itoa(server.Port)
+	}
+	if port, err := strconv.Atoi(prompt("port", "Port", port)); err == nil {
+		server.Port = port
+	}
+	server.User = prompt("user", "User", server.User)
+	core.Info("Password(直接回车不修改)：")
+	input := ""
+	fmt.Scanln(&input)
+	if input != "" {
+		values["password"] = input
+		server.Password = input
+	}
+	server.Method = prompt("method", "Method", server.Method)
+	server.Key = prompt("key", "Key", server.Key)
+	return values
+}
+
+func waitEnter() {
+	core.Info("按回车继续")
+	fmt.Scanln()
+}
+
+// 检查输入，返回序号或全局操作
+func checkInput(app *core.App, entries []core.ServerEntry) (string, bool) {
+	flag := ""
+	for {
+		fmt.Scanln(&flag)
+		core.Log.Info("input scan:", flag)
+
+		if isGlobalInput(flag) {
+			return flag, true
+		}
+
+		if _, ok := app.ServerByFlag(flag); ok {
+			return flag, false
+		}
+		for _, e := range entries {
+			if e.Name == flag {
+				return e.Flag, false
+			}
+		}
+		core.Errorln("输入有误，请重新输入")
+	}
+}
+
+// 判断是否全局输入
+func isGlobalInput(flag string) bool {
+	switch flag {
+	case "edit", "add", "remove", "exit":
+		return true
+	default:
+		return false
+	}
+}
+
+// 打印列表，默认组在前，之后按分组输出
+func showServers(app *core.App, entries []core.ServerEntry) {
+	maxlen := separatorLength(entries)
+	formatSeparator(" 欢迎使用 Auto Login ", "=", maxlen)
+	group := ""
+	for i, e := range entries {
+		if e.Prefix == "" {
+			if i%2 == 0 {
+				core.LoglnB(recordServer(app, e))
+			} else {
+				core.LoglnW(recordServer(app, e))
+			}
+			continue
+		}
+		if e.Prefix != group {
+			group = e.Prefix
+			formatSeparator(" "+e.Group+" ", "_", maxlen)
+		}
+		core.Logln(recordServer(app, e))
+	}
+
+	formatSeparator("", "=", maxlen)
+	core.Logln("", "[add]  添加", "    ", "[edit] 编辑", "    ", "[remove] 删除")
+	core.Logln("", "[exit]\t退出")
+	formatSeparator("", "=", maxlen)
+	core.Info("请输入序号或操作: ")
+}
+
+func formatSeparator(title string, c string, maxlength int) {
+	charslen := int((maxlength - core.ZhLen(title)) / 2.0)
+	core.Infoln(strings.Repeat(c, charslen) + title + strings.Repeat(c, charslen))
+}
+
+func separatorLength(entries []core.ServerEntry) int {
+	maxlength := 60
+	for _, e := range entries {
+		if length := core.ZhLen(e.Group); length > maxlength {
+			maxlength = length + 10
+		}
+	}
+	return maxlength
+}
+
+func recordServer(app *core.App, e core.ServerEntry) string {
+	name := e.Name
+	pad := 0
+	if len(e.Flag) < 3 {
+		pad = 3 - len(e.Flag)
+	}
+	flagMsg := core.SP[0:1] + "[" + core.SP[0:pad] + e.Flag + "]" + core.SP[0:3]
+	if !app.ShowDetail() {
+		return flagMsg + name
+	}
+	if l := core.ZhLen(name); l < len(core.SP) {
+		name = name + core.SP[:len(core.SP)-l]
+	}
+	return flagMsg + name + " [" + e.User + "@" + e.IP + ":" + strconv.Itoa(e.Port) + "]"
+}
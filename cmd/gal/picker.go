@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"gssh/core"
+	"gssh/core/tui"
+	"sort"
+	"strconv"
+)
+
+// 全屏选择服务，支持模糊搜索、分组折叠以及连接、编辑、复制IP
+func pick(app *core.App) {
+	entries, err := app.ListServers(selector)
+	exitOnError(err)
+
+	var items []tui.Item
+	for _, e := range entries {
+		section := "默认分组"
+		if e.Prefix != "" {
+			section = e.Group
+		}
+		detail := e.User + "@" + e.IP + ":" + strconv.Itoa(e.Port)
+		keys := make([]string, 0, len(e.Tags))
+		for k := range e.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tags := ""
+		for _, k := range keys {
+			tags += " " + k + "=" + e.Tags[k]
+		}
+		items = append(items, tui.Item{
+			Section: section,
+			Key:     e.Flag,
+			Label:   e.Name,
+			Detail:  detail + tags,
+			Search:  e.Flag + " " + e.Name + " " + detail + " " + section + tags,
+		})
+	}
+
+	picker := tui.NewPicker("欢迎使用 Auto Login", items, []tui.Action{
+		{Key: tui.Key{Code: tui.KeyEnter}, Name: "connect", Help: "Enter 连接"},
+		{Key: tui.Ctrl('e'), Name: "edit", Help: "Ctrl-E 编辑"},
+		{Key: tui.Ctrl('y'), Name: "copy", Help: "Ctrl-Y 复制IP"},
+	})
+
+	t, err := tui.Open()
+	if err != nil {
+		core.Log.Error("open terminal fail", err)
+		*line = true
+		show(app)
+		return
+	}
+
+	for {
+		res, err := picker.Run(t)
+		if err != nil || res.Action == "" {
+			t.Close()
+			return
+		}
+
+		server, _ := app.ServerByFlag(entries[res.Item].Flag)
+		switch res.Action {
+		case "connect":
+			t.Close()
+			core.Log.Info("select server", server.Name)
+			connect(server)
+			return
+		case "edit":
+			t.Close()
+			core.Clear()
+			editServer(app, server)
+			reload(app)
+			return
+		case "copy":
+			if err := tui.CopyToClipboard(server.IP); err != nil {
+				picker.Status = fmt.Sprint("复制失败：", err)
+			} else {
+				picker.Status = "已复制：" + server.IP
+			}
+		}
+	}
+}
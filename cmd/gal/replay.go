@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gssh/core"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// 回放录像：gal replay [-speed 1] [-idle 2] FILE
+// 回放时空格暂停/继续，+/-调整速度，q退出
+func replayCmd(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "回放速度倍数")
+	idle := fs.Float64("idle", 0, "最长空闲时间（秒），0为不限制")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *speed <= 0 {
+		fmt.Println("gal replay [-speed 1] [-idle 2] FILE")
+		os.Exit(2)
+	}
+
+	player := &core.Player{Speed: *speed, MaxIdle: *idle}
+	stop := make(chan struct{})
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		if oldState, err := term.MakeRaw(fd); err == nil {
+			defer term.Restore(fd, oldState)
+			go replayKeys(player, stop)
+		}
+	}
+
+	err := player.Play(fs.Arg(0), os.Stdout, stop)
+	if err != nil {
+		core.Errorln(err)
+	}
+	fmt.Print("\r\n")
+}
+
+func replayKeys(player *core.Player, stop chan struct{}) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+		switch buf[0] {
+		case ' ':
+			player.TogglePause()
+		case '+', '=':
+			player.SetSpeed(2)
+		case '-', '_':
+			player.SetSpeed(0.5)
+		case 'q', 3:
+			close(stop)
+			return
+		}
+	}
+}
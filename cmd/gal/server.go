@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gssh/core"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 服务管理：gal server add|set|rm
+func serverCmd(app *core.App, args []string) {
+	if len(args) == 0 {
+		serverUsage()
+	}
+
+	var err error
+	switch args[0] {
+	case "add":
+		err = serverAdd(app, args[1:])
+	case "set":
+		if len(args) < 3 {
+			serverUsage()
+		}
+		values := make(map[string]string)
+		for _, kv := range args[2:] {
+			i := strings.Index(kv, "=")
+			if i <= 0 {
+				core.Errorln("参数格式错误，应为key=value：", kv)
+				os.Exit(1)
+			}
+			values[kv[:i]] = kv[i+1:]
+		}
+		err = app.SetServer(args[1], values)
+	case "rm":
+		if len(args) != 2 {
+			serverUsage()
+		}
+		err = app.RemoveServer(args[1])
+	default:
+		serverUsage()
+	}
+	exitOnError(err)
+}
+
+func serverAdd(app *core.App, args []string) error {
+	fs := flag.NewFlagSet("server add", flag.ExitOnError)
+	name := fs.String("name", "", "名称")
+	ip := fs.String("ip", "", "ip")
+	port := fs.Int("port", 0, "端口，默认继承分组或22")
+	user := fs.String("user", "", "用户")
+	group := fs.String("group", "", "分组前缀，默认组为空")
+	method := fs.String("method", "", "登录方式：password、k，默认继承分组")
+	key := fs.String("key", "", "密钥文件")
+	jump := fs.String("jump", "", "跳板机名称")
+	passwordStdin := fs.Bool("password-stdin", false, "从标准输入读取密码")
+	tags := fs.String("tags", "", "标签，例如：role=db,env=prod")
+	fs.Parse(args)
+
+	t, err := core.ParseTags(*tags)
+	if err != nil {
+		return err
+	}
+
+	server := core.Server{
+		Name:   *name,
+		IP:     *ip,
+		Port:   *port,
+		User:   *user,
+		Method: *method,
+		Key:    *key,
+		Jump:   *jump,
+		Tags:   t,
+	}
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("读取密码失败：%v", err)
+		}
+		passwd, err := core.Encrypt(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			return err
+		}
+		server.Password = passwd
+	}
+	return app.AddServer(*group, server)
+}
+
+// 分组管理：gal group add|rm
+func groupCmd(app *core.App, args []string) {
+	if len(args) == 0 {
+		groupUsage()
+	}
+
+	var err error
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("group add", flag.ExitOnError)
+		name := fs.String("name", "", "分组名称")
+		prefix := fs.String("prefix", "", "分组前缀")
+		parent := fs.String("parent", "", "父分组的组合前缀，新增子分组时使用")
+		tags := fs.String("tags", "", "组内服务继承的标签，例如：env=prod")
+		fs.Parse(args[1:])
+		var t map[string]string
+		if t, err = core.ParseTags(*tags); err == nil {
+			err = app.AddGroup(*parent, *name, *prefix, t)
+		}
+	case "rm":
+		fs := flag.NewFlagSet("group rm", flag.ExitOnError)
+		force := fs.Bool("force", false, "分组不为空时也删除")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			groupUsage()
+		}
+		err = app.RemoveGroup(fs.Arg(0), *force)
+	default:
+		groupUsage()
+	}
+	exitOnError(err)
+}
+
+// 列出服务：gal ls [--json]
+func lsCmd(app *core.App, args []string) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "json格式输出")
+	fs.Parse(args)
+
+	entries, err := app.ListServers(selector)
+	exitOnError(err)
+
+	if *asJSON {
+		b, err := json.MarshalIndent(entries, "", "  ")
+		exitOnError(err)
+		fmt.Println(string(b))
+		return
+	}
+	for _, e := range entries {
+		var tags []string
+		for k, v := range e.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		fmt.Println(strings.Join([]string{e.Flag, e.Name, e.User + "@" + e.IP + ":" + strconv.Itoa(e.Port), e.Group, strings.Join(tags, ",")}, "\t"))
+	}
+}
+
+func serverUsage() {
+	fmt.Println("gal server add --name NAME --ip IP --user USER [--port 22] [--group PREFIX] [--method password|k] [--key FILE] [--jump NAME] [--tags k=v,...] [--password-stdin]")
+	fmt.Println("gal server set NAME key=value ...  (name/ip/port/user/password/method/key/jump/group/options.名称/tags.名称)")
+	fmt.Println("gal server rm NAME")
+	os.Exit(2)
+}
+
+func groupUsage() {
+	fmt.Println("gal group add --name NAME --prefix PREFIX [--parent PREFIX] [--tags k=v,...]")
+	fmt.Println("gal group rm [--force] PREFIX  (子分组使用组合前缀)")
+	os.Exit(2)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		core.Errorln(err)
+		os.Exit(1)
+	}
+}
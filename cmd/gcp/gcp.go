@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"gssh/core"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -23,13 +24,13 @@ type GcpPath struct {
 	pathType   int //src:1, dest:2
 }
 
-func newGcpPath(path string, pathType int, app *core.App) (*GcpPath, error) {
+func newGcpPath(arg string, pathType int, app *core.App) (*GcpPath, error) {
 	serverName := LOCAL
-	pathFile := path
-	i := strings.Index(path, ":")
+	pathFile := arg
+	i := strings.Index(arg, ":")
 	if i > 0 {
-		serverName = path[0:i]
-		pathFile = path[i+1:]
+		serverName = arg[0:i]
+		pathFile = arg[i+1:]
 	}
 	if pathFile == "" {
 		pathFile = "./"
@@ -60,20 +61,35 @@ func (gcp *GcpPath) PathFile() string {
 	return filepath.Join(gcp.path, gcp.fileName)
 }
 
+// 服务名:路径，本地路径不带服务名
+func (gcp *GcpPath) String() string {
+	if gcp.IsRemote() {
+		return gcp.serverName + ":" + gcp.PathFile()
+	}
+	return gcp.PathFile()
+}
+
 func (gcp *GcpPath) IsRemote() bool {
 	return gcp.serverName != LOCAL
 }
 
+func (gcp *GcpPath) GetServer() (*core.Server, error) {
+	if gcp.serverName == LOCAL {
+		return nil, errors.New("local path")
+	}
+	return gcp.app.GetServer(gcp.serverName)
+}
+
 func (gcp *GcpPath) GetClient() (*ssh.Client, error) {
 	if gcp.serverName == LOCAL {
 		return nil, errors.New("local path")
 	}
-	server, err := gcp.app.GetServer(gcp.serverName)
+	server, err := gcp.GetServer()
 	if err != nil {
 		core.Errorln("获取服务器错误！", err)
 		return nil, err
 	}
-	client, err := server.GenClient()
+	client, err := server.GenClientContext(ctx)
 	if err != nil {
 		core.Errorln("获取服务器连接错误!", err)
 		return nil, err
@@ -89,52 +105,32 @@ func (gcp *GcpPath) init() error {
 }
 
 func (gcp *GcpPath) remote() error {
-	// server, err := gcp.app.GetServer(gcp.serverName)
-	// if err != nil {
-	// 	core.Errorln("获取服务器错误！", err)
-	// 	return err
-	// }
-	// client, err := server.GenClient()
-	// if err != nil {
-	// 	core.Errorln("获取服务器连接错误!", err)
-	// 	return err
-	// }
 	client, err := gcp.GetClient()
 	if err != nil {
 		core.Errorln("获取ssh client错误！", err)
 		return err
 	}
 	defer client.Close()
-	path, err := core.RemoteParsePath(gcp.path, client)
+	//一次获取文件和上层目录的信息，同时得到绝对路径
+	infos, err := core.NewRemoteFS(client).StatAll(gcp.path, path.Dir(strings.TrimRight(gcp.path, "/")))
 	if err != nil {
-		core.Log.Error("执行远程命令错误", err)
+		core.Log.Error("读取远程文件信息错误", err)
 		return err
 	}
+	fi, parent := infos[0], infos[1]
 
 	if gcp.pathType == SRC_PATH {
 		//如果是源文件，需要判断远程文件是否存在
-		rb, err := core.RemoteIsExists(path, client)
-		if err != nil {
-			core.Log.Error("读取远程文件信息错误", err)
-			return err
-		}
-		if !rb {
+		if fi == nil {
 			return errors.New("源远程文件不存在：" + gcp.path)
 		}
-		//如果是源文件，需要判断是否是文件，而不是文件夹
-		rb, err = core.RemoteIsFile(path, client)
-		if err != nil {
-			core.Log.Error("读取远程文件信息错误", err)
-			return err
-		}
-		if rb {
-			// return errors.New("源远程不是文件：" + gcp.path)
-			gcp.path = filepath.Dir(path)
-			gcp.fileName = filepath.Base(path)
+		if fi.IsDir() {
+			gcp.path = fi.Path
+			gcp.fileName = ""
 			return nil
 		}
-		gcp.path = filepath.Dir(path)
-		gcp.fileName = ""
+		gcp.path = path.Dir(fi.Path)
+		gcp.fileName = fi.Name()
 		return nil
 	}
 	//如果是目标文件，判断逻辑：
@@ -143,37 +139,21 @@ func (gcp *GcpPath) remote() error {
 	//	如果是文件夹，则正确
 	//如果不存在
 	//	判断上层目录是否存在
-	rfe, err := core.RemoteIsExists(path, client)
-	if err != nil {
-		core.Log.Error("读取远程文件信息错误", err)
-		return err
-	}
-	if rfe {
-		gcp.path = path
+	if fi != nil {
+		gcp.path = fi.Path
 		gcp.fileName = ""
-		rf, err := core.RemoteIsFile(path, client)
-		if err != nil {
-			core.Log.Error("读取远程文件信息错误", err)
-			return err
-		}
-		if rf {
+		if !fi.IsDir() {
 			//目标文件已经存在了，目前采用报错机制
 			return errors.New("目标文件已经存在")
 		}
 		return nil
 	}
-	//远程文件不存在
-	gcp.path = filepath.Dir(path)
-	gcp.fileName = filepath.Base(path)
-	//判断上层文件夹是否存在
-	rb, err := core.RemoteIsExists(gcp.path, client)
-	if err != nil {
-		core.Log.Error("读取远程文件信息错误", err)
-		return err
-	}
-	if !rb {
+	//远程文件不存在，判断上层文件夹是否存在
+	if parent == nil || !parent.IsDir() {
 		return errors.New("目标文件夹不存在")
 	}
+	gcp.fileName = path.Base(gcp.path)
+	gcp.path = parent.Path
 	return nil
 }
 
@@ -206,9 +186,9 @@ func (gcp *GcpPath) local() error {
 		}
 		return nil
 	}
-	//目标文件不存在
-	gcp.path = core.PathName(path)
-	gcp.fileName = core.FileName(path)
+	//目标文件不存在，PathName对不存在的路径返回原路径，这里取上层目录
+	gcp.path = filepath.Dir(path)
+	gcp.fileName = filepath.Base(path)
 	if !core.IsExist(gcp.path) {
 		return errors.New("目标文件夹不存在")
 	}
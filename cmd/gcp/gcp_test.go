@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gssh/core"
+	"gssh/core/sshtest"
+)
+
+// 启动测试服务，配置文件中的服务名为test
+func newTestApp(t *testing.T) (*sshtest.Server, *core.App) {
+	t.Helper()
+	s, err := sshtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	password, err := core.Encrypt(s.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := core.Config{
+		Servers: []core.Server{{
+			Name:     "test",
+			IP:       s.Host(),
+			Port:     s.Port(),
+			User:     s.User,
+			Password: password,
+		}},
+	}
+	data, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(t.TempDir(), "al.conf")
+	if err := ioutil.WriteFile(configFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return s, &core.App{ConfigPath: configFile}
+}
+
+func TestRemoteGcpPath(t *testing.T) {
+	s, app := newTestApp(t)
+	if err := os.MkdirAll(filepath.Join(s.Dir, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.Dir, "dir", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg      string
+		pathType int
+		path     string
+		fileName string
+		wantErr  bool
+	}{
+		{"test:dir/a.txt", SRC_PATH, filepath.Join(s.Dir, "dir"), "a.txt", false},
+		{"test:~/dir/sub/", SRC_PATH, filepath.Join(s.Dir, "dir", "sub"), "", false},
+		{"test:", SRC_PATH, s.Dir, "", false},
+		{"test:missing", SRC_PATH, "", "", true},
+		{"test:dir", DEST_PATH, filepath.Join(s.Dir, "dir"), "", false},
+		{"test:dir/new.txt", DEST_PATH, filepath.Join(s.Dir, "dir"), "new.txt", false},
+		{"test:dir/a.txt", DEST_PATH, "", "", true},
+		{"test:missing/new.txt", DEST_PATH, "", "", true},
+		{"nobody:dir", SRC_PATH, "", "", true},
+	}
+	for _, tt := range tests {
+		gp, err := newGcpPath(tt.arg, tt.pathType, app)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("newGcpPath(%q, %d) succeeded", tt.arg, tt.pathType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newGcpPath(%q, %d): %v", tt.arg, tt.pathType, err)
+			continue
+		}
+		if gp.path != tt.path || gp.fileName != tt.fileName {
+			t.Errorf("newGcpPath(%q, %d) = %q %q, want %q %q", tt.arg, tt.pathType, gp.path, gp.fileName, tt.path, tt.fileName)
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	s, app := newTestApp(t)
+	local := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(local, "up", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "up", "sub", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传目录到已存在的远程目录中
+	src, dest, err := newPaths(app, filepath.Join(local, "up"), "test:~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transfer(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(s.Dir, "up", "sub", "b.txt")); err != nil || string(data) != "b" {
+		t.Fatalf("uploaded %q, %v", data, err)
+	}
+
+	// 下载文件并改名
+	src, dest, err = newPaths(app, "test:up/sub/b.txt", filepath.Join(local, "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transfer(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(local, "c.txt")); err != nil || string(data) != "b" {
+		t.Fatalf("downloaded %q, %v", data, err)
+	}
+}
+
+func TestLocalGcpPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg      string
+		pathType int
+		path     string
+		fileName string
+		wantErr  bool
+	}{
+		{file, SRC_PATH, dir, "a.txt", false},
+		{dir, SRC_PATH, dir, "", false},
+		{filepath.Join(dir, "missing"), SRC_PATH, "", "", true},
+		{dir, DEST_PATH, dir, "", false},
+		{filepath.Join(dir, "new.txt"), DEST_PATH, dir, "new.txt", false},
+		{file, DEST_PATH, "", "", true},
+		{filepath.Join(dir, "missing", "new.txt"), DEST_PATH, "", "", true},
+	}
+	for _, tt := range tests {
+		gp, err := newGcpPath(tt.arg, tt.pathType, nil)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("newGcpPath(%q, %d) succeeded", tt.arg, tt.pathType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newGcpPath(%q, %d): %v", tt.arg, tt.pathType, err)
+			continue
+		}
+		if gp.path != tt.path || gp.fileName != tt.fileName {
+			t.Errorf("newGcpPath(%q, %d) = %q %q, want %q %q", tt.arg, tt.pathType, gp.path, gp.fileName, tt.path, tt.fileName)
+		}
+	}
+}
+
+func TestParsePerms(t *testing.T) {
+	tests := []struct {
+		chmod, umask string
+		dir, file    os.FileMode
+		exec         os.FileMode
+		wantErr      bool
+	}{
+		{"D755,F644", "", 0755, 0644, 0644, false},
+		{"u+rwX,go-w", "", 0755, 0644, 0754, false},
+		{"a=rX", "", 0555, 0444, 0555, false},
+		{"Fgo=", "", 0775, 0600, 0700, false},
+		{"", "027", 0750, 0640, 0750, false},
+		{"D777,F666", "022", 0755, 0644, 0644, false},
+		{"F0755", "", 0775, 0755, 0755, false},
+		{"D", "", 0, 0, 0, true},
+		{"F1755", "", 0, 0, 0, true},
+		{"u+q", "", 0, 0, 0, true},
+		{"go", "", 0, 0, 0, true},
+		{"", "888", 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		fn, err := parsePerms(tt.chmod, tt.umask)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePerms(%q, %q) succeeded", tt.chmod, tt.umask)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePerms(%q, %q): %v", tt.chmod, tt.umask, err)
+			continue
+		}
+		// 源文件：目录775，普通文件664，可执行文件754
+		dir, file, exec := fn(os.ModeDir|0775)&os.ModePerm, fn(0664), fn(0754)
+		if dir != tt.dir || file != tt.file || exec != tt.exec {
+			t.Errorf("parsePerms(%q, %q) = %v %v %v, want %v %v %v", tt.chmod, tt.umask, dir, file, exec, tt.dir, tt.file, tt.exec)
+		}
+	}
+	if fn, err := parsePerms("", ""); fn != nil || err != nil {
+		t.Errorf("parsePerms without rules = %v, %v", fn != nil, err)
+	}
+}
+
+func TestCheckOwner(t *testing.T) {
+	for _, owner := range []string{"www", "www:www", ":staff", "deploy.user:web-data"} {
+		if err := checkOwner(owner); err != nil {
+			t.Errorf("checkOwner(%q): %v", owner, err)
+		}
+	}
+	for _, owner := range []string{":", "a:b:c", "root;id", "a b"} {
+		if checkOwner(owner) == nil {
+			t.Errorf("checkOwner(%q) succeeded", owner)
+		}
+	}
+}
+
+func TestTransferChmod(t *testing.T) {
+	s, app := newTestApp(t)
+	local := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(local, "site", "bin"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "site", "index.html"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(local, "site", "bin", "run"), []byte("x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := chmod
+	defer func() { chmod = old }()
+	var err error
+	if chmod, err = parsePerms("D755,Fu=rwX,go=rX", "027"); err != nil {
+		t.Fatal(err)
+	}
+
+	src, dest, err := newPaths(app, filepath.Join(local, "site"), "test:~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := remoteTarget(src, dest); got != filepath.ToSlash(filepath.Join(s.Dir, "site")) {
+		t.Errorf("remoteTarget = %q", got)
+	}
+	if err := transfer(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"site": 0750, "site/bin": 0750, "site/index.html": 0640, "site/bin/run": 0750} {
+		fi, err := os.Stat(filepath.Join(s.Dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModePerm != want {
+			t.Errorf("%s: mode = %v, want %v", name, fi.Mode()&os.ModePerm, want)
+		}
+	}
+}
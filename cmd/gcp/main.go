@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"gssh/core"
 	"gssh/core/scp"
 	"os"
+	"os/signal"
 	"strings"
-
-	"golang.org/x/crypto/ssh"
+	"time"
 )
 
 var (
@@ -20,6 +22,21 @@ var (
 	v      = flag.Bool("v", false, "版本信息")
 	help   = flag.Bool("help", false, "帮助")
 	config = flag.String("c", "", "配置文件，默认al.conf")
+	sel    = flag.String("s", "", "按标签选择多台服务器上传，例如：role=web,env!=prod")
+	idle   = flag.Duration("idle-timeout", time.Minute, "传输停滞（没有数据）超过该时间后中断，0为不检查")
+	links  = flag.String("symlinks", "follow", "目录中的符号链接：follow 复制指向的文件，skip 跳过，preserve 保留为链接")
+	perms  = flag.Bool("p", true, "保留权限和时间（默认），-p=false 同 -no-perms")
+	noPerm = flag.Bool("no-perms", false, "不保留权限和时间，新文件的权限受目标端umask限制，已有文件保持原权限")
+	modes  = flag.String("chmod", "", "修改传输的文件权限，逗号分隔，D开头只用于目录，F开头只用于文件，例如 D755,F644 或 u+rwX,go-w")
+	umask  = flag.String("umask", "", "按该umask去掉权限，例如022，不依赖本地文件的权限")
+	owner  = flag.String("chown", "", "上传后通过sudo修改属主，例如 www:www，上传也通过sudo执行（需要免密码sudo）")
+
+	// Ctrl-C时取消连接和传输
+	ctx = context.Background()
+	// 拷贝目录时符号链接的处理方式
+	symlinks = scp.FollowSymlinks
+	// 修改传输的文件权限，nil时使用源文件的权限
+	chmod func(os.FileMode) os.FileMode
 )
 
 func main() {
@@ -32,44 +49,170 @@ func main() {
 		}
 	}()
 
-	configFile := core.ReadConfigPath(*config)
+	configFile, err := core.ReadConfigPath(*config)
+	if err != nil {
+		core.Errorln(err)
+		os.Exit(1)
+	}
+	if symlinks, err = parseSymlinks(*links); err != nil {
+		core.Errorln(err)
+		os.Exit(2)
+	}
+	if chmod, err = parsePerms(*modes, *umask); err != nil {
+		core.Errorln(err)
+		os.Exit(2)
+	}
+	if *owner != "" {
+		if err = checkOwner(*owner); err != nil {
+			core.Errorln(err)
+			os.Exit(2)
+		}
+	}
+	scp.ShowProgress = true
+	var stop context.CancelFunc
+	ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
 	app := core.App{
 		ConfigPath: configFile,
 	}
 
+	if *sel != "" {
+		fanOut(&app)
+		return
+	}
+
 	src, dest := parsePath(&app)
-	var client *ssh.Client
-	var err error
-	if src.IsRemote() {
-		client, err = src.GetClient()
-		if err != nil {
-			core.Errorln("获取ssh client错误", err)
-		}
+	if err := transfer(src, dest); err != nil {
+		core.Errorln("拷贝失败：", err)
+		os.Exit(1)
 	}
+}
+
+func transfer(src, dest *GcpPath) error {
+	remote, direction := src, "download"
 	if dest.IsRemote() {
-		client, err = dest.GetClient()
-		if err != nil {
-			core.Errorln("获取ssh client错误", err)
-		}
+		remote, direction = dest, "upload"
+	}
+	if !remote.IsRemote() {
+		return errors.New("源和目标至少需要一个远程路径")
+	}
+	if *owner != "" && direction != "upload" {
+		return errors.New("-chown 只能用于上传")
+	}
+	server, err := remote.GetServer()
+	if err != nil {
+		core.Errorln("获取服务器错误！", err)
+		return err
+	}
+	client, err := remote.GetClient()
+	if err != nil {
+		core.Errorln("获取ssh client错误", err)
+		return err
 	}
+	defer client.Close()
 
 	s := scp.NewSCP(client)
+	s.SetContext(ctx)
+	s.IdleTimeout = *idle
+	s.Symlinks = symlinks
+	s.NoPermissions = *noPerm || !*perms
+	s.Chmod = chmod
+	if *owner != "" {
+		s.SCPCommand = "sudo -n scp"
+	}
+	s.Warn = func(path string, err error) {
+		core.Errorln(fmt.Sprintf("跳过 %s：%v", path, err))
+	}
+	err = copyFiles(s, src, dest)
+	if err == nil && *owner != "" {
+		err = chown(client, *owner, remoteTarget(src, dest))
+	}
+	core.AuditTransfer(server, direction, src.String(), dest.String(), s.Transferred(), err)
+	if err == nil {
+		return nil
+	}
+	// 下载时不完整的本地文件已经删除，上传时删除不完整的远程文件
+	if partial := s.Partial(); partial != "" {
+		if rmErr := s.RemovePartial(); rmErr != nil {
+			core.Log.Error("remove partial file fail", partial, rmErr)
+		} else {
+			core.Log.Info("remove partial file", partial)
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errors.New("已取消")
+	case errors.Is(err, scp.ErrStalled):
+		return fmt.Errorf("超过%v没有传输数据，已中断", *idle)
+	}
+	return err
+}
 
+func copyFiles(s *scp.SCP, src, dest *GcpPath) error {
 	if src.IsRemote() {
 		if src.IsDir() {
-			s.ReceiveDir(src.PathFile(), dest.PathFile(), nil)
-			return
+			return s.ReceiveDir(src.PathFile(), dest.PathFile(), nil)
 		}
-		s.ReceiveFile(src.PathFile(), dest.PathFile())
-		return
+		return s.ReceiveFile(src.PathFile(), dest.PathFile())
 	}
 	if src.IsDir() {
-		s.SendDir(src.PathFile(), dest.PathFile(), nil)
-		return
+		return s.SendDir(src.PathFile(), dest.PathFile(), nil)
 	}
 
-	s.SendFile(src.PathFile(), dest.PathFile())
-	// fmt.Println(app)
+	return s.SendFile(src.PathFile(), dest.PathFile())
+}
+
+// 解析-symlinks参数
+func parseSymlinks(v string) (scp.SymlinkMode, error) {
+	switch v {
+	case "follow":
+		return scp.FollowSymlinks, nil
+	case "skip":
+		return scp.SkipSymlinks, nil
+	case "preserve":
+		return scp.PreserveSymlinks, nil
+	}
+	return 0, errors.New("-symlinks 应为follow、skip或preserve：" + v)
+}
+
+// 上传到选择器匹配的所有服务器，目标路径格式为 :路径
+func fanOut(app *core.App) {
+	srcPath := strings.TrimRight(flag.Arg(0), " ")
+	destPath := strings.TrimRight(flag.Arg(1), " ")
+	if srcPath == "" || !strings.HasPrefix(destPath, ":") {
+		flag.Usage()
+		core.Infoln("gcp -s role=db 源文件 :目标文件")
+		os.Exit(0)
+	}
+
+	servers, err := app.SelectServers(*sel)
+	if err != nil {
+		core.Errorln("获取服务器错误！", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, server := range servers {
+		if ctx.Err() != nil {
+			failed++
+			continue
+		}
+		core.Infoln(fmt.Sprintf("==== %s (%s@%s) ====", server.Name, server.User, server.IP))
+		src, dest, err := newPaths(app, srcPath, server.Name+destPath)
+		if err == nil {
+			err = transfer(src, dest)
+		}
+		if err != nil {
+			failed++
+			core.Errorln("拷贝失败：", err)
+		}
+	}
+
+	core.Infoln(fmt.Sprintf("共%d台服务器，失败%d台", len(servers), failed))
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
 
 func parsePath(app *core.App) (*GcpPath, *GcpPath) {
@@ -79,22 +222,29 @@ func parsePath(app *core.App) (*GcpPath, *GcpPath) {
 	if srcPath == "" || descPath == "" {
 		flag.Usage()
 		core.Infoln("gcp 源文件 目标文件")
+		core.Infoln("gcp -s role=db 源文件 :目标文件")
 		os.Exit(0)
 	}
-	src, err := newGcpPath(srcPath, SRC_PATH, app)
-	dest, err := newGcpPath(descPath, DEST_PATH, app)
+	src, dest, err := newPaths(app, srcPath, descPath)
 	if err != nil {
 		core.Errorln(err)
 		os.Exit(0)
 	}
+	return src, dest
+}
+
+func newPaths(app *core.App, srcPath, descPath string) (*GcpPath, *GcpPath, error) {
+	src, err := newGcpPath(srcPath, SRC_PATH, app)
 	if err != nil {
-		core.Errorln(err)
-		os.Exit(0)
+		return nil, nil, err
+	}
+	dest, err := newGcpPath(descPath, DEST_PATH, app)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if src.IsDir() && !dest.IsDir() {
-		core.Errorln("源是目录，目标是一个文件，请检查")
-		os.Exit(0)
+		return nil, nil, errors.New("源是目录，目标是一个文件，请检查")
 	}
 
 	core.Infoln("--------------------------------------------")
@@ -102,7 +252,7 @@ func parsePath(app *core.App) (*GcpPath, *GcpPath) {
 	core.Info("  ====>   ")
 	core.Infoln(fmt.Sprintf("目标文件: [%s, %s]", dest.path, dest.fileName))
 	core.Infoln("--------------------------------------------")
-	return src, dest
+	return src, dest, nil
 }
 
 func cmdParse() {
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"gssh/core"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 一条-chmod规则，例如 D755、F644、u+x、Dg-w
+type chmodRule struct {
+	// 只用于目录或只用于文件，都为false时用于所有
+	dirs, files bool
+	// 修改的位：u 0700、g 0070、o 0007
+	who os.FileMode
+	ops []chmodOp
+}
+
+type chmodOp struct {
+	// =、+、-
+	op   byte
+	perm os.FileMode
+	// X：目录或已有执行权限时才加执行权限
+	execIfAny bool
+}
+
+// 解析-chmod参数，多条规则用逗号分隔，按顺序执行
+func parseChmod(spec string) ([]chmodRule, error) {
+	var rules []chmodRule
+	for _, item := range strings.Split(spec, ",") {
+		rule, err := parseChmodRule(item)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseChmodRule(item string) (chmodRule, error) {
+	bad := errors.New("-chmod 规则格式错误：" + item)
+	var rule chmodRule
+	s := item
+	switch {
+	case strings.HasPrefix(s, "D"):
+		rule.dirs, s = true, s[1:]
+	case strings.HasPrefix(s, "F"):
+		rule.files, s = true, s[1:]
+	}
+	if s == "" {
+		return rule, bad
+	}
+
+	// 八进制权限，scp不能传输setuid等特殊位
+	if s[0] >= '0' && s[0] <= '7' {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || m > 0777 || len(s) > 4 {
+			return rule, bad
+		}
+		rule.who = 0777
+		rule.ops = []chmodOp{{op: '=', perm: os.FileMode(m)}}
+		return rule, nil
+	}
+
+	for ; s != "" && strings.IndexByte("ugoa", s[0]) >= 0; s = s[1:] {
+		switch s[0] {
+		case 'u':
+			rule.who |= 0700
+		case 'g':
+			rule.who |= 0070
+		case 'o':
+			rule.who |= 0007
+		case 'a':
+			rule.who |= 0777
+		}
+	}
+	if rule.who == 0 {
+		rule.who = 0777
+	}
+	for s != "" {
+		op := chmodOp{op: s[0]}
+		if strings.IndexByte("=+-", op.op) < 0 {
+			return rule, bad
+		}
+		for s = s[1:]; s != "" && strings.IndexByte("=+-", s[0]) < 0; s = s[1:] {
+			switch s[0] {
+			case 'r':
+				op.perm |= 0444
+			case 'w':
+				op.perm |= 0222
+			case 'x':
+				op.perm |= 0111
+			case 'X':
+				op.execIfAny = true
+			default:
+				return rule, bad
+			}
+		}
+		rule.ops = append(rule.ops, op)
+	}
+	if len(rule.ops) == 0 {
+		return rule, bad
+	}
+	return rule, nil
+}
+
+// 按规则修改权限，mode中目录带有os.ModeDir
+func applyChmod(rules []chmodRule, mode os.FileMode) os.FileMode {
+	perm := mode & os.ModePerm
+	for _, rule := range rules {
+		if rule.dirs && !mode.IsDir() || rule.files && mode.IsDir() {
+			continue
+		}
+		for _, op := range rule.ops {
+			bits := op.perm
+			if op.execIfAny && (mode.IsDir() || perm&0111 != 0) {
+				bits |= 0111
+			}
+			bits &= rule.who
+			switch op.op {
+			case '=':
+				perm = perm&^rule.who | bits
+			case '+':
+				perm |= bits
+			case '-':
+				perm &^= bits
+			}
+		}
+	}
+	return mode&^os.ModePerm | perm
+}
+
+// 解析-umask参数，例如 022
+func parseUmask(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, errors.New("-umask 应为八进制权限，例如022：" + s)
+	}
+	return os.FileMode(m), nil
+}
+
+// 根据-chmod和-umask生成修改权限的函数，都没有设置时返回nil，使用源文件的权限
+func parsePerms(chmodSpec, umaskSpec string) (func(os.FileMode) os.FileMode, error) {
+	if chmodSpec == "" && umaskSpec == "" {
+		return nil, nil
+	}
+	var rules []chmodRule
+	var mask os.FileMode
+	var err error
+	if chmodSpec != "" {
+		if rules, err = parseChmod(chmodSpec); err != nil {
+			return nil, err
+		}
+	}
+	if umaskSpec != "" {
+		if mask, err = parseUmask(umaskSpec); err != nil {
+			return nil, err
+		}
+	}
+	return func(mode os.FileMode) os.FileMode {
+		return applyChmod(rules, mode) &^ mask
+	}, nil
+}
+
+var ownerPattern = regexp.MustCompile(`^[A-Za-z0-9._-]*(:[A-Za-z0-9._-]*)?$`)
+
+// 检查-chown参数，格式 user、user:group 或 :group
+func checkOwner(owner string) error {
+	if owner == "" || owner == ":" || !ownerPattern.MatchString(owner) {
+		return errors.New("-chown 应为 user:group：" + owner)
+	}
+	return nil
+}
+
+// 上传后远程文件或目录的路径
+func remoteTarget(src, dest *GcpPath) string {
+	if !dest.IsDir() {
+		return path.Join(dest.path, dest.fileName)
+	}
+	name := src.fileName
+	if src.IsDir() {
+		name = filepath.Base(src.path)
+	}
+	return path.Join(dest.path, name)
+}
+
+// 通过sudo修改上传的文件或目录的属主，sudo需要免密码
+func chown(client *ssh.Client, owner, target string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	out, err := session.CombinedOutput(core.ShellCommand("sudo", "-n", "chown", "-R", "--", owner, target))
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New("修改属主失败：" + msg)
+		}
+		return errors.New("修改属主失败：" + err.Error())
+	}
+	return nil
+}
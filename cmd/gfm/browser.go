@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"gssh/core/tui"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 一个文件面板，entries第一项为上级目录（根目录除外）
+type pane struct {
+	fs      fileSystem
+	dir     string
+	entries []os.FileInfo
+	cursor  int
+	offset  int
+}
+
+// 上级目录项
+type parentInfo struct {
+	os.FileInfo
+}
+
+func (parentInfo) Name() string { return ".." }
+
+// 读取当前目录，保留光标位置
+func (p *pane) load() error {
+	list, err := readDir(p.fs, p.dir)
+	if err != nil {
+		return err
+	}
+	if parent := p.fs.Dir(p.dir); parent != p.dir {
+		if fi, err := p.fs.Stat(parent); err == nil {
+			list = append([]os.FileInfo{parentInfo{fi}}, list...)
+		}
+	}
+	p.entries = list
+	if p.cursor >= len(p.entries) {
+		p.cursor = len(p.entries) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	return nil
+}
+
+// 进入目录，失败时保持原目录
+func (p *pane) chdir(dir string) error {
+	old := p.dir
+	p.dir = dir
+	p.cursor, p.offset = 0, 0
+	if err := p.load(); err != nil {
+		p.dir = old
+		p.load()
+		return err
+	}
+	return nil
+}
+
+// 返回上级目录，光标停留在原目录
+func (p *pane) up() error {
+	parent := p.fs.Dir(p.dir)
+	if parent == p.dir {
+		return nil
+	}
+	name := p.dir[strings.LastIndexAny(p.dir, "/\\")+1:]
+	if err := p.chdir(parent); err != nil {
+		return err
+	}
+	for i, fi := range p.entries {
+		if fi.Name() == name {
+			p.cursor = i
+		}
+	}
+	return nil
+}
+
+func (p *pane) current() os.FileInfo {
+	if p.cursor < 0 || p.cursor >= len(p.entries) {
+		return nil
+	}
+	return p.entries[p.cursor]
+}
+
+// 当前项的绝对路径，没有或为上级目录时返回空
+func (p *pane) currentPath() string {
+	fi := p.current()
+	if fi == nil {
+		return ""
+	}
+	if _, ok := fi.(parentInfo); ok {
+		return ""
+	}
+	return p.fs.Join(p.dir, fi.Name())
+}
+
+func (p *pane) move(n int) {
+	p.cursor += n
+	if p.cursor >= len(p.entries) {
+		p.cursor = len(p.entries) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// 两个面板的文件管理器，左侧本地，右侧远程
+type browser struct {
+	s      *session
+	t      *tui.Terminal
+	panes  [2]*pane
+	active int
+	status string
+}
+
+func newBrowser(s *session, localDir, remoteDir string) (*browser, error) {
+	b := &browser{
+		s: s,
+		panes: [2]*pane{
+			{fs: s.local, dir: localDir},
+			{fs: s.remote, dir: remoteDir},
+		},
+		active: 1,
+	}
+	for _, p := range b.panes {
+		if err := p.load(); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+var browserHelp = "Tab 切换  Enter 打开  F3/v 查看  F5/c 复制  F6/r 重命名  F7/m 新建目录  F8/d 删除  p 权限  g 刷新  q 退出"
+
+func (b *browser) run() error {
+	t, err := tui.Open()
+	if err != nil {
+		return err
+	}
+	b.t = t
+	defer func() {
+		b.t.Close()
+	}()
+
+	for {
+		b.render()
+		key, err := b.t.ReadKey()
+		if err != nil {
+			return err
+		}
+		b.status = ""
+		p := b.panes[b.active]
+		_, h := b.t.Size()
+		page := h - 4
+
+		switch {
+		case key.Code == tui.KeyTab:
+			b.active = 1 - b.active
+		case key.Code == tui.KeyUp || key == tui.Ctrl('p'):
+			p.move(-1)
+		case key.Code == tui.KeyDown || key == tui.Ctrl('n'):
+			p.move(1)
+		case key.Code == tui.KeyPgUp:
+			p.move(-page)
+		case key.Code == tui.KeyPgDn:
+			p.move(page)
+		case key.Code == tui.KeyHome:
+			p.cursor = 0
+		case key.Code == tui.KeyEnd:
+			p.cursor = len(p.entries) - 1
+		case key.Code == tui.KeyEnter || key.Code == tui.KeyRight:
+			b.open(p)
+		case key.Code == tui.KeyBackspace || key.Code == tui.KeyLeft:
+			b.check(p.up())
+		case isKey(key, 3, 'v'):
+			b.view(p)
+		case isKey(key, 5, 'c'):
+			b.copy(p)
+		case isKey(key, 6, 'r'):
+			b.rename(p)
+		case isKey(key, 7, 'm'):
+			b.mkdir(p)
+		case isKey(key, 8, 'd') || key.Code == tui.KeyDelete:
+			b.remove(p)
+		case key.Code == tui.KeyRune && key.Rune == 'p':
+			b.chmod(p)
+		case key.Code == tui.KeyRune && key.Rune == 'g' || key == tui.Ctrl('r'):
+			b.reload()
+		case isKey(key, 10, 'q') || key.Code == tui.KeyEsc || key == tui.Ctrl('c'):
+			return nil
+		}
+	}
+}
+
+// 功能键或对应的字母
+func isKey(key tui.Key, f int, r rune) bool {
+	return key.Code == tui.KeyF && key.Rune == rune(f) || key.Code == tui.KeyRune && key.Rune == r
+}
+
+func (b *browser) check(err error) bool {
+	if err != nil {
+		b.status = fmt.Sprint("错误：", err)
+		return false
+	}
+	return true
+}
+
+func (b *browser) reload() {
+	for _, p := range b.panes {
+		b.check(p.load())
+	}
+}
+
+// 打开目录或查看文件，符号链接按指向的文件处理
+func (b *browser) open(p *pane) {
+	fi := p.current()
+	if fi == nil {
+		return
+	}
+	if _, ok := fi.(parentInfo); ok {
+		b.check(p.up())
+		return
+	}
+	name := p.currentPath()
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := p.fs.Stat(name)
+		if !b.check(err) {
+			return
+		}
+		fi = target
+	}
+	if fi.IsDir() {
+		b.check(p.chdir(name))
+		return
+	}
+	b.view(p)
+}
+
+func (b *browser) copy(p *pane) {
+	name := p.currentPath()
+	if name == "" {
+		return
+	}
+	other := b.panes[1-b.active]
+	target := other.fs.Join(other.dir, p.current().Name())
+	if _, err := other.fs.Stat(target); err == nil {
+		if !b.confirm(fmt.Sprintf("%s 已存在，覆盖？", target)) {
+			return
+		}
+	}
+
+	resume, err := b.t.Suspend()
+	if !b.check(err) {
+		return
+	}
+	fmt.Printf("%s:%s  ====>  %s:%s\n", p.fs.Name(), name, other.fs.Name(), other.dir)
+	err = b.s.copy(p.fs, name, other.dir)
+	if err != nil {
+		fmt.Println("拷贝失败：", err)
+	} else {
+		fmt.Println("拷贝完成")
+	}
+	fmt.Print("按回车继续")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	if err := resume(); err != nil {
+		b.status = fmt.Sprint("错误：", err)
+	}
+	b.reload()
+}
+
+func (b *browser) rename(p *pane) {
+	name := p.currentPath()
+	if name == "" {
+		return
+	}
+	newName, ok := b.input("重命名为：", p.current().Name())
+	if !ok || newName == "" || newName == p.current().Name() {
+		return
+	}
+	target, err := p.fs.Resolve(p.dir, newName)
+	if b.check(err) && b.check(p.fs.Rename(name, target)) {
+		b.reload()
+	}
+}
+
+func (b *browser) mkdir(p *pane) {
+	name, ok := b.input("新建目录：", "")
+	if !ok || name == "" {
+		return
+	}
+	dir, err := p.fs.Resolve(p.dir, name)
+	if b.check(err) && b.check(p.fs.Mkdir(dir)) {
+		b.reload()
+	}
+}
+
+func (b *browser) remove(p *pane) {
+	name := p.currentPath()
+	if name == "" {
+		return
+	}
+	msg := "删除 " + name + "？"
+	if p.current().IsDir() {
+		msg = "删除目录 " + name + " 及其中的所有文件？"
+	}
+	if !b.confirm(msg) {
+		return
+	}
+	if b.check(p.fs.RemoveAll(name)) {
+		b.status = "已删除：" + name
+		b.reload()
+	}
+}
+
+func (b *browser) chmod(p *pane) {
+	name := p.currentPath()
+	if name == "" {
+		return
+	}
+	perm := strconv.FormatUint(uint64(p.current().Mode().Perm()), 8)
+	s, ok := b.input("权限（八进制）：", perm)
+	if !ok || s == "" || s == perm {
+		return
+	}
+	mode, err := parseMode(s)
+	if b.check(err) && b.check(p.fs.Chmod(name, mode)) {
+		b.reload()
+	}
+}
+
+func (b *browser) confirm(msg string) bool {
+	s, ok := b.input(msg+" (y/N) ", "")
+	return ok && strings.ToLower(s) == "y"
+}
+
+// 在状态行输入，Enter确认，Esc取消
+func (b *browser) input(label, value string) (string, bool) {
+	buf := []rune(value)
+	for {
+		_, h := b.t.Size()
+		text := label + string(buf)
+		b.t.Line(h-2, text, "")
+		b.t.ShowCursor(h-2, tui.Width(text))
+		b.t.Flush()
+
+		key, err := b.t.ReadKey()
+		if err != nil {
+			return "", false
+		}
+		switch {
+		case key.Code == tui.KeyEnter:
+			b.t.HideCursor()
+			return strings.TrimSpace(string(buf)), true
+		case key.Code == tui.KeyEsc || key == tui.Ctrl('c'):
+			b.t.HideCursor()
+			return "", false
+		case key.Code == tui.KeyBackspace:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		case key == tui.Ctrl('u'):
+			buf = buf[:0]
+		case key.Code == tui.KeyRune:
+			buf = append(buf, key.Rune)
+		}
+	}
+}
+
+func (b *browser) render() {
+	t := b.t
+	w, h := t.Size()
+	listHeight := h - 4
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	width := (w - 1) / 2
+
+	t.Clear()
+	t.Line(0, fmt.Sprintf(" gfm  %s (%s@%s)", b.s.server.Name, b.s.server.User, b.s.server.IP), "1;32")
+	for i, p := range b.panes {
+		col := i * (width + 1)
+		style := "2"
+		if i == b.active {
+			style = "1;36"
+		}
+		t.Text(1, col, tui.Pad(" "+p.fs.Name()+": "+p.dir, width), style)
+
+		if p.cursor < p.offset {
+			p.offset = p.cursor
+		}
+		if p.cursor >= p.offset+listHeight {
+			p.offset = p.cursor - listHeight + 1
+		}
+		for row := 0; row < listHeight; row++ {
+			if i == 1 {
+				t.Text(2+row, width, "│", "2")
+			}
+			n := p.offset + row
+			if n >= len(p.entries) {
+				continue
+			}
+			t.Text(2+row, col, entryLine(p.entries[n], width), entryStyle(p.entries[n], i == b.active && n == p.cursor))
+		}
+	}
+
+	status := b.status
+	if status == "" {
+		if fi := b.panes[b.active].current(); fi != nil {
+			if _, ok := fi.(parentInfo); !ok {
+				status = formatEntry(fi)
+			}
+		}
+	}
+	t.Line(h-2, status, "33")
+	t.Line(h-1, browserHelp, "2")
+	t.Flush()
+}
+
+// 面板中的一行：名称 大小
+func entryLine(fi os.FileInfo, width int) string {
+	name := fi.Name()
+	size := humanSize(fi.Size())
+	switch {
+	case name == "..":
+		size = ""
+	case fi.IsDir():
+		name += "/"
+		size = "<DIR>"
+	case fi.Mode()&os.ModeSymlink != 0:
+		name += "@"
+	}
+	nameWidth := width - 9
+	if nameWidth < 1 {
+		return tui.Pad(name, width)
+	}
+	return " " + tui.Pad(name, nameWidth-1) + fmt.Sprintf("%8s", size) + " "
+}
+
+func entryStyle(fi os.FileInfo, selected bool) string {
+	if selected {
+		return "7"
+	}
+	switch {
+	case fi.IsDir():
+		return "1;34"
+	case fi.Mode()&os.ModeSymlink != 0:
+		return "36"
+	case fi.Mode()&0111 != 0:
+		return "32"
+	}
+	return ""
+}
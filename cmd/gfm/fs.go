@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gssh/core"
+	"gssh/core/scp"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 查看文件的最大大小
+const maxViewSize = 1 << 20
+
+// 面板使用的文件系统，本地和远程实现相同的操作，路径都是绝对路径
+type fileSystem interface {
+	Name() string
+	ReadDir(dir string) ([]os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldname, newname string) error
+	RemoveAll(name string) error
+	Chmod(name string, mode os.FileMode) error
+	Mkdir(name string) error
+	ReadFile(name string) ([]byte, error)
+	//Resolve 相对于dir的路径转换为绝对路径
+	Resolve(dir, name string) (string, error)
+	Join(dir, name string) string
+	Dir(name string) string
+}
+
+type localFS struct{}
+
+func (localFS) Name() string { return "本地" }
+
+func (localFS) ReadDir(dir string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dir)
+}
+
+func (localFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (localFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (localFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (localFS) Mkdir(name string) error {
+	return os.MkdirAll(name, 0755)
+}
+
+func (localFS) ReadFile(name string) ([]byte, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > maxViewSize {
+		return nil, errTooLarge
+	}
+	return ioutil.ReadFile(name)
+}
+
+func (localFS) Resolve(dir, name string) (string, error) {
+	if name == "" {
+		return dir, nil
+	}
+	if strings.HasPrefix(name, "~") || filepath.IsAbs(name) {
+		return core.ParsePath(name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func (localFS) Join(dir, name string) string {
+	return filepath.Join(dir, name)
+}
+
+func (localFS) Dir(name string) string {
+	return filepath.Dir(name)
+}
+
+type remoteFS struct {
+	client *core.Client
+	fs     *core.RemoteFS
+}
+
+func newRemoteFS(client *core.Client) *remoteFS {
+	return &remoteFS{client: client, fs: client.FS()}
+}
+
+func (r *remoteFS) Name() string { return r.client.Server().Name }
+
+func (r *remoteFS) ReadDir(dir string) ([]os.FileInfo, error) {
+	list, err := r.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(list))
+	for _, fi := range list {
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+func (r *remoteFS) Stat(name string) (os.FileInfo, error) {
+	fi, err := r.fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (r *remoteFS) Rename(oldname, newname string) error {
+	return r.fs.Rename(oldname, newname)
+}
+
+func (r *remoteFS) RemoveAll(name string) error {
+	return r.fs.RemoveAll(name)
+}
+
+func (r *remoteFS) Chmod(name string, mode os.FileMode) error {
+	return r.fs.Chmod(name, mode)
+}
+
+func (r *remoteFS) Mkdir(name string) error {
+	return r.fs.MkdirAll(name, 0755)
+}
+
+func (r *remoteFS) ReadFile(name string) ([]byte, error) {
+	fi, err := r.fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > maxViewSize {
+		return nil, errTooLarge
+	}
+	var buf bytes.Buffer
+	_, err = scp.NewSCP(r.client.Client).Receive(fi.Path, &buf)
+	return buf.Bytes(), err
+}
+
+func (r *remoteFS) Resolve(dir, name string) (string, error) {
+	if name == "" {
+		return dir, nil
+	}
+	if !strings.HasPrefix(name, "~") && !strings.HasPrefix(name, "/") {
+		name = path.Join(dir, name)
+	}
+	return r.fs.Realpath(name)
+}
+
+func (r *remoteFS) Join(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func (r *remoteFS) Dir(name string) string {
+	return path.Dir(name)
+}
+
+var errTooLarge = fmt.Errorf("文件超过%s，请下载后查看", humanSize(maxViewSize))
+
+// 读取目录，目录在前，按名称排序
+func readDir(fs fileSystem, dir string) ([]os.FileInfo, error) {
+	list, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		di, dj := list[i].IsDir(), list[j].IsDir()
+		if di != dj {
+			return di
+		}
+		return strings.ToLower(list[i].Name()) < strings.ToLower(list[j].Name())
+	})
+	return list, nil
+}
+
+// 文件内容是否是文本
+func isText(b []byte) bool {
+	return !bytes.Contains(b, []byte{0})
+}
+
+// 解析八进制权限，例如 644、0755
+func parseMode(s string) (os.FileMode, error) {
+	var m uint32
+	if s == "" || len(s) > 4 {
+		return 0, errors.New("权限格式错误：" + s)
+	}
+	for _, c := range s {
+		if c < '0' || c > '7' {
+			return 0, errors.New("权限格式错误：" + s)
+		}
+		m = m*8 + uint32(c-'0')
+	}
+	mode := os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// 文件大小，例如 512、1.2K、3.4M
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// 类似 ls -l 的一行：权限 大小 修改时间 名称
+func formatEntry(fi os.FileInfo) string {
+	name := fi.Name()
+	if fi.IsDir() {
+		name += "/"
+	} else if fi.Mode()&os.ModeSymlink != 0 {
+		name += "@"
+	}
+	return fmt.Sprintf("%s %7s %s %s", fi.Mode(), humanSize(fi.Size()), fi.ModTime().Format("2006-01-02 15:04"), name)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gssh/core"
+	"gssh/core/tui"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	//Version 版本信息
+	Version = "0.1.1"
+	//Build 编译时间
+	Build = "20190301"
+
+	v      = flag.Bool("v", false, "版本信息")
+	help   = flag.Bool("help", false, "帮助")
+	config = flag.String("c", "", "配置文件，默认al.conf")
+	line   = flag.Bool("l", false, "命令行模式（类似sftp），不使用全屏界面")
+)
+
+func main() {
+	cmdParse()
+	version()
+
+	defer func() {
+		if err := recover(); err != nil {
+			core.Log.Error("recover", err)
+		}
+	}()
+
+	target := strings.TrimSpace(flag.Arg(0))
+	if target == "" {
+		flag.Usage()
+		core.Infoln("gfm 服务器[:远程目录] [本地目录]")
+		os.Exit(0)
+	}
+	serverName, remoteDir := target, "~"
+	if i := strings.Index(target, ":"); i > 0 {
+		serverName, remoteDir = target[:i], target[i+1:]
+	}
+
+	configFile, err := core.ReadConfigPath(*config)
+	if err != nil {
+		core.Errorln(err)
+		os.Exit(1)
+	}
+	app := core.App{
+		ConfigPath: configFile,
+	}
+	server, err := app.GetServer(serverName)
+	if err != nil {
+		core.Errorln("获取服务器错误！", err)
+		os.Exit(1)
+	}
+
+	// 连接时可以用Ctrl-C取消
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	client, err := server.Dial(ctx)
+	stop()
+	if err != nil {
+		core.Errorln("获取服务器连接错误!", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	s := newSession(server, client)
+	localDir, err := s.local.Resolve(".", flag.Arg(1))
+	if err == nil {
+		localDir, err = filepath.Abs(localDir)
+	}
+	if err != nil {
+		core.Errorln("本地目录错误：", err)
+		os.Exit(1)
+	}
+	if remoteDir == "" {
+		remoteDir = "~"
+	}
+	remoteDir, err = s.remote.Resolve("~", remoteDir)
+	if err != nil {
+		core.Errorln("远程目录错误：", err)
+		os.Exit(1)
+	}
+
+	if *line || !tui.IsTerminal() {
+		p := &prompt{s: s, localDir: localDir, remoteDir: remoteDir}
+		p.run()
+		return
+	}
+	b, err := newBrowser(s, localDir, remoteDir)
+	if err != nil {
+		core.Errorln("读取目录错误：", err)
+		os.Exit(1)
+	}
+	if err := b.run(); err != nil {
+		core.Errorln(err)
+		os.Exit(1)
+	}
+}
+
+func cmdParse() {
+	flag.Parse()
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+}
+
+func version() {
+	if *v {
+		fmt.Println("gfm version: " + Version + ", Build " + Build + "。")
+		fmt.Println("本程序源码：https://github.com/lcl101/rcmd。")
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gssh/core"
+	"os"
+	"strings"
+)
+
+var promptHelp = `命令（远程路径相对于远程当前目录，本地命令以l开头）：
+  ls [目录]            列出远程目录
+  lls [目录]           列出本地目录
+  cd 目录 / lcd 目录   切换远程 / 本地目录
+  pwd / lpwd           显示远程 / 本地当前目录
+  get 远程文件 [本地目录]  下载文件或目录
+  put 本地文件 [远程目录]  上传文件或目录
+  cat 远程文件         查看远程文本文件
+  rename 旧名称 新名称  重命名远程文件
+  rm 远程文件          删除远程文件或目录
+  mkdir 远程目录       新建远程目录
+  chmod 权限 远程文件  修改远程文件权限，例如 chmod 644 a.txt
+  help                 帮助
+  exit                 退出`
+
+// 类似sftp的命令行模式
+type prompt struct {
+	s         *session
+	localDir  string
+	remoteDir string
+}
+
+func (p *prompt) run() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("gfm> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			core.Errorln(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" || args[0] == "bye" {
+			return
+		}
+		if err := p.exec(args[0], args[1:]); err != nil {
+			core.Errorln(err)
+		}
+	}
+}
+
+func (p *prompt) exec(cmd string, args []string) error {
+	switch cmd {
+	case "help", "?":
+		fmt.Println(promptHelp)
+	case "pwd":
+		fmt.Println(p.remoteDir)
+	case "lpwd":
+		fmt.Println(p.localDir)
+	case "ls":
+		return p.list(p.s.remote, p.remoteDir, args)
+	case "lls":
+		return p.list(p.s.local, p.localDir, args)
+	case "cd":
+		dir, err := p.chdir(p.s.remote, p.remoteDir, args)
+		if err == nil {
+			p.remoteDir = dir
+		}
+		return err
+	case "lcd":
+		dir, err := p.chdir(p.s.local, p.localDir, args)
+		if err == nil {
+			p.localDir = dir
+		}
+		return err
+	case "get":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("用法：get 远程文件 [本地目录]")
+		}
+		remote, err := p.s.remote.Resolve(p.remoteDir, args[0])
+		if err != nil {
+			return err
+		}
+		local, err := p.s.local.Resolve(p.localDir, arg(args, 1))
+		if err != nil {
+			return err
+		}
+		return p.s.download(remote, local)
+	case "put":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("用法：put 本地文件 [远程目录]")
+		}
+		local, err := p.s.local.Resolve(p.localDir, args[0])
+		if err != nil {
+			return err
+		}
+		remote, err := p.s.remote.Resolve(p.remoteDir, arg(args, 1))
+		if err != nil {
+			return err
+		}
+		return p.s.upload(local, remote)
+	case "cat":
+		if len(args) != 1 {
+			return errors.New("用法：cat 远程文件")
+		}
+		name, err := p.s.remote.Resolve(p.remoteDir, args[0])
+		if err != nil {
+			return err
+		}
+		data, err := p.s.remote.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if !isText(data) {
+			return errors.New("二进制文件，不能查看：" + name)
+		}
+		os.Stdout.Write(data)
+	case "rename":
+		if len(args) != 2 {
+			return errors.New("用法：rename 旧名称 新名称")
+		}
+		from, err := p.s.remote.Resolve(p.remoteDir, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := p.s.remote.Resolve(p.remoteDir, args[1])
+		if err != nil {
+			return err
+		}
+		return p.s.remote.Rename(from, to)
+	case "rm":
+		if len(args) != 1 {
+			return errors.New("用法：rm 远程文件")
+		}
+		name, err := p.s.remote.Resolve(p.remoteDir, args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := p.s.remote.Stat(name); err != nil {
+			return err
+		}
+		return p.s.remote.RemoveAll(name)
+	case "mkdir":
+		if len(args) != 1 {
+			return errors.New("用法：mkdir 远程目录")
+		}
+		name, err := p.s.remote.Resolve(p.remoteDir, args[0])
+		if err != nil {
+			return err
+		}
+		return p.s.remote.Mkdir(name)
+	case "chmod":
+		if len(args) != 2 {
+			return errors.New("用法：chmod 权限 远程文件")
+		}
+		mode, err := parseMode(args[0])
+		if err != nil {
+			return err
+		}
+		name, err := p.s.remote.Resolve(p.remoteDir, args[1])
+		if err != nil {
+			return err
+		}
+		return p.s.remote.Chmod(name, mode)
+	default:
+		return errors.New("未知命令：" + cmd + "，输入help查看帮助")
+	}
+	return nil
+}
+
+func (p *prompt) list(fs fileSystem, cwd string, args []string) error {
+	dir, err := fs.Resolve(cwd, arg(args, 0))
+	if err != nil {
+		return err
+	}
+	list, err := readDir(fs, dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range list {
+		fmt.Println(formatEntry(fi))
+	}
+	return nil
+}
+
+func (p *prompt) chdir(fs fileSystem, cwd string, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("用法：cd 目录")
+	}
+	name := arg(args, 0)
+	if name == "" {
+		name = "~"
+	}
+	dir, err := fs.Resolve(cwd, name)
+	if err != nil {
+		return "", err
+	}
+	fi, err := fs.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", errors.New("不是目录：" + dir)
+	}
+	return dir, nil
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// 按空格拆分参数，支持单引号、双引号和反斜杠转义
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg, quote, escape := false, rune(0), false
+	for _, r := range line {
+		switch {
+		case escape:
+			cur.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escape {
+		return nil, errors.New("引号或转义不完整")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gssh/core"
+	"gssh/core/scp"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+)
+
+// 一次连接中的本地和远程文件系统
+type session struct {
+	server *core.Server
+	client *core.Client
+	local  localFS
+	remote *remoteFS
+}
+
+func newSession(server *core.Server, client *core.Client) *session {
+	return &session{
+		server: server,
+		client: client,
+		remote: newRemoteFS(client),
+	}
+}
+
+// 上传本地文件或目录到远程目录
+func (s *session) upload(local, remoteDir string) error {
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	remote := remoteDir
+	if !fi.IsDir() {
+		remote = path.Join(remoteDir, filepath.Base(local))
+	}
+	return transfer(func(ctx context.Context) error {
+		return s.client.UploadContext(ctx, local, remote)
+	})
+}
+
+// 下载远程文件或目录到本地目录
+func (s *session) download(remote, localDir string) error {
+	return transfer(func(ctx context.Context) error {
+		return s.client.DownloadContext(ctx, remote, localDir)
+	})
+}
+
+// 在两个文件系统之间复制，name为源文件的绝对路径，dir为目标目录
+func (s *session) copy(from fileSystem, name, dir string) error {
+	if from == s.remote {
+		return s.download(name, dir)
+	}
+	return s.upload(name, dir)
+}
+
+// 显示传输进度，Ctrl-C取消传输
+func transfer(fn func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	scp.ShowProgress = true
+	defer func() {
+		scp.ShowProgress = false
+	}()
+	err := fn(ctx)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("已取消")
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"gssh/core/tui"
+	"strings"
+)
+
+// 全屏查看文本文件，q、Esc或F3退出
+func (b *browser) view(p *pane) {
+	name := p.currentPath()
+	if name == "" {
+		return
+	}
+	if p.current().IsDir() {
+		return
+	}
+	b.status = "读取中..."
+	b.render()
+	data, err := p.fs.ReadFile(name)
+	b.status = ""
+	if !b.check(err) {
+		return
+	}
+	if !isText(data) {
+		b.status = "二进制文件，不能查看：" + name
+		return
+	}
+	lines := viewLines(string(data))
+
+	offset := 0
+	for {
+		_, h := b.t.Size()
+		height := h - 2
+		if height < 1 {
+			height = 1
+		}
+		if last := len(lines) - height; offset > last {
+			offset = last
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		b.t.Clear()
+		b.t.Line(0, fmt.Sprintf(" %s:%s  (%d/%d)", p.fs.Name(), name, offset+1, len(lines)), "1;32")
+		for i := 0; i < height && offset+i < len(lines); i++ {
+			b.t.Line(1+i, lines[offset+i], "")
+		}
+		b.t.Line(h-1, "↑↓ 滚动  PgUp/PgDn 翻页  Home/End 开头/结尾  q 返回", "2")
+		b.t.Flush()
+
+		key, err := b.t.ReadKey()
+		if err != nil {
+			return
+		}
+		switch {
+		case key.Code == tui.KeyUp || key == tui.Ctrl('p') || key.Code == tui.KeyRune && key.Rune == 'k':
+			offset--
+		case key.Code == tui.KeyDown || key == tui.Ctrl('n') || key.Code == tui.KeyRune && key.Rune == 'j':
+			offset++
+		case key.Code == tui.KeyPgUp || key.Code == tui.KeyRune && key.Rune == 'b':
+			offset -= height
+		case key.Code == tui.KeyPgDn || key.Code == tui.KeyRune && key.Rune == ' ':
+			offset += height
+		case key.Code == tui.KeyHome || key.Code == tui.KeyRune && key.Rune == 'g':
+			offset = 0
+		case key.Code == tui.KeyEnd || key.Code == tui.KeyRune && key.Rune == 'G':
+			offset = len(lines)
+		case isKey(key, 3, 'q') || key.Code == tui.KeyEsc || key == tui.Ctrl('c'):
+			return
+		}
+	}
+}
+
+// 按行拆分，制表符替换为空格，其他控制字符替换为?
+func viewLines(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.TrimSuffix(s, "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Map(func(r rune) rune {
+			if r < 0x20 && r != '\t' || r == 0x7f {
+				return '?'
+			}
+			return r
+		}, strings.Replace(line, "\t", "    ", -1))
+	}
+	return lines
+}
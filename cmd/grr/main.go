@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"gssh/core"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
 )
 
 var (
@@ -13,9 +21,13 @@ var (
 	//Build 编译时间
 	Build = "20190301"
 
-	v      = flag.Bool("v", false, "版本信息")
-	help   = flag.Bool("help", false, "帮助")
-	config = flag.String("c", "", "配置文件，默认al.conf")
+	v        = flag.Bool("v", false, "版本信息")
+	help     = flag.Bool("help", false, "帮助")
+	config   = flag.String("c", "", "配置文件，默认al.conf")
+	sel      = flag.String("s", "", "按标签选择多台服务器执行，例如：role=db,env!=prod")
+	parallel = flag.Int("p", 10, "多台服务器执行时的并发数")
+	tty      = flag.Bool("t", false, "在终端（pty）中执行，按服务的expect规则自动应答，例如su/sudo密码")
+	timeout  = flag.Duration("timeout", 0, "每台服务器执行命令的超时时间，例如：30s、5m，0为不限制")
 )
 
 func main() {
@@ -30,26 +42,66 @@ func main() {
 
 	serverName, codes := parseCmd()
 
-	configFile := core.ReadConfigPath(*config)
+	configFile, err := core.ReadConfigPath(*config)
+	if err != nil {
+		core.Errorln(err)
+		os.Exit(1)
+	}
 	app := core.App{
 		ConfigPath: configFile,
 	}
+
+	// Ctrl-C时结束远程命令并关闭连接
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *sel != "" {
+		runSelected(ctx, &app, codes)
+		return
+	}
 	server, err := app.GetServer(serverName)
 	if err != nil {
 		core.Errorln("获取服务器错误！", err)
 		os.Exit(1)
 	}
 
-	client, err := server.GenClient()
+	client, err := server.GenClientContext(ctx)
 	if err != nil {
 		core.Errorln("获取服务器连接错误!", err)
 		os.Exit(1)
 	}
 	defer client.Close()
 
+	runCtx, cancel := commandContext(ctx)
+	defer cancel()
+	if *tty {
+		// 和gal登录一样把本地终端设为raw模式，输入只由远程终端回显，手动输入的密码不会显示在本地
+		fd := int(os.Stdin.Fd())
+		var oldState *term.State
+		if term.IsTerminal(fd) {
+			if oldState, err = term.MakeRaw(fd); err != nil {
+				core.Log.Error("make raw terminal fail", err)
+			}
+		}
+		code, err := server.RunPtyContext(runCtx, client, strings.Join(codes, "&&"), os.Stdout, os.Stdin)
+		if oldState != nil {
+			term.Restore(fd, oldState)
+		}
+		if err != nil {
+			core.Errorln("执行命令异常:", contextMsg(runCtx, err))
+			os.Exit(1)
+		}
+		os.Exit(code)
+	}
+
 	cmd := core.NewCmd(client)
+	cmd.SetServer(server)
 	cmd.SetCmds(codes)
-	cmd.Run()
+	cmd.RunContext(runCtx)
+	if runCtx.Err() != nil {
+		core.Errorln("执行命令异常:", contextMsg(runCtx, runCtx.Err()))
+		os.Exit(1)
+	}
 	if cmd.GetRtnCode() == 0 {
 		core.Infoln(cmd.GetRtnMsg())
 		return
@@ -63,14 +115,155 @@ func main() {
 
 func parseCmd() (string, []string) {
 	cmds := flag.Args()
+	if *sel != "" && len(cmds) > 0 {
+		return "", cmds
+	}
 	if len(cmds) < 2 {
 		flag.Usage()
 		core.Infoln("gcmd serverName 'ls -lart'")
+		core.Infoln("gcmd -s role=db,env!=prod 'ls -lart'")
 		os.Exit(0)
 	}
 	return cmds[0], cmds[1:]
 }
 
+type result struct {
+	server *core.Server
+	cmd    *core.Cmd
+	err    error
+	// 执行命令的错误（超时、取消、pty执行失败）
+	runErr error
+	// -t 模式的输出和退出码
+	output string
+	code   int
+}
+
+// 命令的上下文，设置了-timeout时超时后结束命令
+func commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(ctx, *timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// 超时和取消的提示
+func contextMsg(ctx context.Context, err error) string {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Sprintf("执行超时（%v）", *timeout)
+	case context.Canceled:
+		return "已取消"
+	}
+	return err.Error()
+}
+
+// 并发写入的输出，超时后远程输出可能仍在写入
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// 在选择器匹配的所有服务器上并发执行
+func runSelected(ctx context.Context, app *core.App, codes []string) {
+	servers, err := app.SelectServers(*sel)
+	if err != nil {
+		core.Errorln("获取服务器错误！", err)
+		os.Exit(1)
+	}
+
+	n := *parallel
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	results := make(chan result, len(servers))
+	for _, server := range servers {
+		go func(server *core.Server) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			client, err := server.GenClientContext(ctx)
+			if err != nil {
+				results <- result{server: server, err: err}
+				return
+			}
+			defer client.Close()
+
+			runCtx, cancel := commandContext(ctx)
+			defer cancel()
+			if *tty {
+				var out syncBuffer
+				code, err := server.RunPtyContext(runCtx, client, strings.Join(codes, "&&"), &out, nil)
+				if err != nil {
+					err = errors.New(contextMsg(runCtx, err))
+				}
+				results <- result{server: server, runErr: err, output: out.String(), code: code}
+				return
+			}
+
+			cmd := core.NewCmd(client)
+			cmd.SetServer(server)
+			cmd.SetCmds(codes)
+			cmd.RunContext(runCtx)
+			if runCtx.Err() != nil {
+				results <- result{server: server, runErr: errors.New(contextMsg(runCtx, runCtx.Err()))}
+				return
+			}
+			results <- result{server: server, cmd: cmd}
+		}(server)
+	}
+
+	failed := 0
+	for range servers {
+		r := <-results
+		title := fmt.Sprintf("==== %s (%s@%s) ====", r.server.Name, r.server.User, r.server.IP)
+		switch {
+		case r.err != nil:
+			failed++
+			core.Errorln(title)
+			core.Errorln("获取服务器连接错误!", r.err)
+		case r.runErr != nil:
+			failed++
+			core.Errorln(title)
+			core.Errorln("执行命令异常:", r.runErr)
+			fmt.Print(r.output)
+		case r.cmd == nil:
+			if r.code != 0 {
+				failed++
+				core.Errorln(title)
+				core.Errorln(fmt.Sprintf("执行命令异常: exit=%d", r.code))
+			} else {
+				core.Infoln(title)
+			}
+			fmt.Print(r.output)
+		case r.cmd.GetRtnCode() != 0:
+			failed++
+			core.Errorln(title)
+			core.Errorln("执行命令异常:", r.cmd.ResultMsg())
+		default:
+			core.Infoln(title)
+			fmt.Print(r.cmd.GetRtnMsg())
+		}
+	}
+
+	core.Infoln(fmt.Sprintf("共%d台服务器，失败%d台", len(servers), failed))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
 func cmdParse() {
 	flag.Parse()
 	if *help {
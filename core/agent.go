@@ -0,0 +1,27 @@
+package core
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// 转发本地ssh-agent（ForwardAgent），远程的git等命令可以使用本地的密钥
+func (server *Server) forwardAgent(client *ssh.Client, session *ssh.Session) {
+	if on, _ := server.Options["ForwardAgent"].(bool); !on {
+		return
+	}
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		Log.Error("ForwardAgent: SSH_AUTH_SOCK not set")
+		return
+	}
+	if err := agent.ForwardToRemote(client, sock); err != nil {
+		Log.Error("ForwardAgent fail", err)
+		return
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		Log.Error("request agent forwarding fail", err)
+	}
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// asciicast v2 文件头，参考 https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+//Recorder 会话录像，保存为asciicast v2格式
+type Recorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	w     *bufio.Writer
+	start time.Time
+	// 不完整的utf8字符留到下一次写入
+	pending map[string][]byte
+}
+
+//NewRecorder 创建录像文件
+func NewRecorder(path string, width, height int, title string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		start:   time.Now(),
+		pending: make(map[string][]byte),
+	}
+	b, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env: map[string]string{
+			"TERM":  os.Getenv("TERM"),
+			"SHELL": os.Getenv("SHELL"),
+		},
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Write(b)
+	r.w.WriteByte('\n')
+	return r, nil
+}
+
+// 录像文件路径：RecordDir/服务名-时间.cast，RecordDir默认为程序目录下的records
+func recordPath(server *Server) string {
+	dir, _ := server.Options["RecordDir"].(string)
+	if dir == "" {
+		exec, _ := GetExecPath()
+		dir = exec + "records"
+	}
+	dir, _ = ParsePath(dir)
+	return filepath.Join(dir, server.Name+"-"+time.Now().Format("20060102150405")+".cast")
+}
+
+func (r *Recorder) event(typ string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+
+	data = append(r.pending[typ], data...)
+	// 末尾不完整的utf8字符
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending[typ] = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return
+	}
+
+	b, err := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6,
+		typ,
+		string(data[:cut]),
+	})
+	if err != nil {
+		return
+	}
+	r.w.Write(b)
+	r.w.WriteByte('\n')
+}
+
+type castWriter struct {
+	r   *Recorder
+	typ string
+}
+
+func (w castWriter) Write(p []byte) (int, error) {
+	w.r.event(w.typ, p)
+	return len(p), nil
+}
+
+//Output 记录终端输出
+func (r *Recorder) Output() io.Writer {
+	return castWriter{r: r, typ: "o"}
+}
+
+//Input 记录键盘输入
+func (r *Recorder) Input() io.Writer {
+	return castWriter{r: r, typ: "i"}
+}
+
+//Resize 记录窗口大小变化
+func (r *Recorder) Resize(width, height int) {
+	r.event("r", []byte(strconv.Itoa(width)+"x"+strconv.Itoa(height)))
+}
+
+//Close 关闭录像文件
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return nil
+	}
+	r.w.Flush()
+	r.w = nil
+	return r.f.Close()
+}
+
+//Player 录像回放
+type Player struct {
+	//Speed 回放速度倍数
+	Speed float64
+	//MaxIdle 最长等待时间（秒），大于0时压缩空闲时间
+	MaxIdle float64
+
+	mu     sync.Mutex
+	paused bool
+}
+
+//TogglePause 暂停/继续
+func (p *Player) TogglePause() {
+	p.mu.Lock()
+	p.paused = !p.paused
+	p.mu.Unlock()
+}
+
+//SetSpeed 调整速度，factor为倍数
+func (p *Player) SetSpeed(factor float64) {
+	p.mu.Lock()
+	p.Speed *= factor
+	p.mu.Unlock()
+}
+
+func (p *Player) state() (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Speed, p.paused
+}
+
+//Play 回放录像，stop关闭时结束
+func (p *Player) Play(path string, out io.Writer, stop <-chan struct{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var header castHeader
+	if err := dec.Decode(&header); err != nil {
+		return errors.New("录像文件格式错误：" + err.Error())
+	}
+	if header.Version != 2 {
+		return errors.New("不支持的录像版本：" + strconv.Itoa(header.Version))
+	}
+
+	// wait为录像中到下一个事件的剩余时间（秒），多睡的时间为负数，从下一次等待中扣除
+	prev, wait := 0.0, 0.0
+	for {
+		var ev []interface{}
+		if err := dec.Decode(&ev); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.New("录像文件格式错误：" + err.Error())
+		}
+		if len(ev) != 3 {
+			continue
+		}
+		t, _ := ev[0].(float64)
+		typ, _ := ev[1].(string)
+		data, _ := ev[2].(string)
+
+		gap := t - prev
+		prev = t
+		if p.MaxIdle > 0 && gap > p.MaxIdle {
+			gap = p.MaxIdle
+		}
+		wait += gap
+		for wait > 0 {
+			speed, paused := p.state()
+			if speed <= 0 {
+				speed = 1
+			}
+			// 每次最多睡50ms，及时响应暂停和调速，按实际经过的时间扣除
+			sleep := wait / speed
+			if sleep > 0.05 || paused {
+				sleep = 0.05
+			}
+			start := time.Now()
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(time.Duration(sleep * float64(time.Second))):
+			}
+			if !paused {
+				wait -= time.Since(start).Seconds() * speed
+			}
+		}
+
+		if typ == "o" {
+			if _, err := io.WriteString(out, data); err != nil {
+				return err
+			}
+		}
+	}
+}
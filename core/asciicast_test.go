@@ -0,0 +1,56 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 写入count个输出事件的录像，事件间隔gap秒
+func writeCast(t *testing.T, count int, gap float64) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString(`{"version": 2, "width": 80, "height": 24}` + "\n")
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&b, "[%.3f, \"o\", \"x\"]\n", float64(i)*gap)
+	}
+	name := filepath.Join(t.TempDir(), "test.cast")
+	if err := ioutil.WriteFile(name, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestPlayerTiming(t *testing.T) {
+	tests := []struct {
+		count    int
+		gap      float64
+		speed    float64
+		min, max time.Duration
+	}{
+		// 短间隔按实际时间回放，不按50ms的步长
+		{40, 0.005, 1, 150 * time.Millisecond, 600 * time.Millisecond},
+		// 速度对短间隔同样有效
+		{100, 0.01, 5, 150 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		name := writeCast(t, tt.count, tt.gap)
+		var out bytes.Buffer
+		p := &Player{Speed: tt.speed}
+		start := time.Now()
+		if err := p.Play(name, &out, nil); err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		if out.String() != strings.Repeat("x", tt.count) {
+			t.Errorf("output = %q", out.String())
+		}
+		if elapsed < tt.min || elapsed > tt.max {
+			t.Errorf("%d events every %vs at speed %v took %v, want %v-%v", tt.count, tt.gap, tt.speed, elapsed, tt.min, tt.max)
+		}
+	}
+}
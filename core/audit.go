@@ -0,0 +1,76 @@
+package core
+
+import (
+	"os"
+	"time"
+)
+
+// 审计事件类型
+const (
+	auditLogin    = "login"
+	auditLogout   = "logout"
+	auditCommand  = "command"
+	auditTransfer = "transfer"
+)
+
+// 审计记录的公共字段：本地用户和服务信息
+func auditFields(event string, server *Server, err error) Fields {
+	fields := Fields{
+		"event":      event,
+		"local_user": localUser(),
+	}
+	if server != nil {
+		fields["server"] = server.Name
+		fields["ip"] = server.IP
+		fields["user"] = server.User
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	return fields
+}
+
+func auditLevel(err error) Level {
+	if err != nil {
+		return LevelError
+	}
+	return LevelInfo
+}
+
+func localUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return os.Getenv("USERNAME")
+}
+
+//AuditLogin 记录登录
+func AuditLogin(server *Server, err error) {
+	Audit.Log(auditLevel(err), auditLogin, auditFields(auditLogin, server, err))
+}
+
+//AuditLogout 记录退出登录，code为远程shell的退出码
+func AuditLogout(server *Server, start time.Time, code int) {
+	fields := auditFields(auditLogout, server, nil)
+	fields["exit_code"] = code
+	fields["duration"] = time.Since(start).Round(time.Millisecond).String()
+	Audit.Log(LevelInfo, auditLogout, fields)
+}
+
+//AuditCommand 记录远程命令及退出码
+func AuditCommand(server *Server, command string, code int, err error) {
+	fields := auditFields(auditCommand, server, err)
+	fields["command"] = command
+	fields["exit_code"] = code
+	Audit.Log(auditLevel(err), auditCommand, fields)
+}
+
+//AuditTransfer 记录文件传输，direction为upload或download
+func AuditTransfer(server *Server, direction, src, dest string, bytes int64, err error) {
+	fields := auditFields(auditTransfer, server, err)
+	fields["direction"] = direction
+	fields["src"] = src
+	fields["dest"] = dest
+	fields["bytes"] = bytes
+	Audit.Log(auditLevel(err), auditTransfer, fields)
+}
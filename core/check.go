@@ -0,0 +1,333 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Problem 配置文件问题
+type Problem struct {
+	Location string
+	Message  string
+}
+
+func (p Problem) String() string {
+	return p.Location + ": " + p.Message
+}
+
+// 支持的登录方式
+var methods = map[string]bool{
+	"password": true,
+	"k":        true,
+}
+
+//Check 检查配置文件，返回发现的所有问题
+func (app *App) Check() ([]Problem, error) {
+	b, err := ioutil.ReadFile(app.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{}
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		c.add(app.ConfigPath+jsonErrorPos(b, err), "配置文件解析失败："+err.Error())
+		return c.problems, nil
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		c.add(app.ConfigPath, "配置文件必须是json对象")
+		return c.problems, nil
+	}
+	c.checkRaw(raw)
+
+	c.flags = make(map[string]string)
+	c.names = make(map[string]string)
+	c.checkOptions("options", config.Options)
+	walkGroups(config.Groups, rootScope, func(scope *groupScope) {
+		c.checkGroup(scope)
+	})
+
+	app.config = config
+	var servers []*Server
+	app.eachServer(func(flag string, scope *groupScope, server *Server) {
+		loc := "servers[" + strconv.Itoa(indexOf(scope.servers(&app.config), server)) + "]"
+		if scope.loc != "" {
+			loc = scope.loc + "." + loc
+		}
+		resolved := server.resolve(scope, config.Options)
+		c.checkServer(loc, flag, server, resolved)
+		servers = append(servers, resolved)
+	})
+	c.checkJumps(servers)
+	return c.problems, nil
+}
+
+type checker struct {
+	problems []Problem
+	// 已使用的标识和名称，值为位置
+	flags map[string]string
+	names map[string]string
+}
+
+func (c *checker) add(location, msg string) {
+	c.problems = append(c.problems, Problem{Location: location, Message: msg})
+}
+
+// 检查分组默认值
+func (c *checker) checkGroup(scope *groupScope) {
+	group := scope.group
+	loc := scope.loc
+	if group.GroupName == "" {
+		c.add(loc, "分组名称为空")
+	} else {
+		loc += "(" + scope.title + ")"
+	}
+	if group.Port < 0 || group.Port > 65535 {
+		c.add(loc, "端口无效："+strconv.Itoa(group.Port))
+	}
+	if group.Method != "" && !methods[group.Method] {
+		c.add(loc, "未知的method："+group.Method+"，可选值：password、k")
+	}
+	c.checkOptions(loc+".options", group.Options)
+}
+
+// 检查跳板机是否存在以及循环引用
+func (c *checker) checkJumps(servers []*Server) {
+	byName := make(map[string]*Server)
+	for _, s := range servers {
+		if _, ok := byName[s.Name]; !ok {
+			byName[s.Name] = s
+		}
+	}
+	for _, s := range servers {
+		if s.Jump == "" {
+			continue
+		}
+		if _, ok := byName[s.Jump]; !ok {
+			c.add(c.names[s.Name], "跳板机不存在："+s.Jump)
+			continue
+		}
+		seen := map[string]bool{s.Name: true}
+		for j := byName[s.Jump]; j != nil; j = byName[j.Jump] {
+			if seen[j.Name] {
+				c.add(c.names[s.Name], "跳板机存在循环引用："+j.Name)
+				break
+			}
+			seen[j.Name] = true
+		}
+	}
+}
+
+// server为配置中的服务，resolved为合并分组默认值后的服务
+func (c *checker) checkServer(loc, flag string, server, resolved *Server) {
+	if server.Name != "" {
+		loc += "(" + server.Name + ")"
+	}
+
+	if prev, ok := c.flags[flag]; ok {
+		c.add(loc, "标识["+flag+"]与"+prev+"重复")
+	} else {
+		c.flags[flag] = loc
+	}
+
+	if server.Name == "" {
+		c.add(loc, "缺少name")
+	} else if prev, ok := c.names[server.Name]; ok {
+		c.add(loc, "名称与"+prev+"重复")
+	} else {
+		c.names[server.Name] = loc
+	}
+
+	if server.IP == "" {
+		c.add(loc, "缺少ip")
+	}
+	if resolved.User == "" {
+		c.add(loc, "缺少user")
+	}
+	if server.Port < 0 || server.Port > 65535 {
+		c.add(loc, "端口无效："+strconv.Itoa(server.Port))
+	}
+	if server.Method != "" && !methods[server.Method] {
+		c.add(loc, "未知的method："+server.Method+"，可选值：password、k")
+	}
+
+	passwd := ""
+	if resolved.Method != "k" && server.Password != "" {
+		p, err := Decrypt(server.Password)
+		if err != nil {
+			c.add(loc, "密码无法解密（是否未加密？）："+err.Error())
+		} else if !utf8.ValidString(p) {
+			c.add(loc, "密码解密结果异常，请检查加密key是否一致")
+		}
+		passwd = server.Password
+	}
+	if passwd == "" {
+		if _, err := pemKey(resolved.Key); err != nil {
+			key := resolved.Key
+			if key == "" {
+				key = "~/.ssh/id_rsa"
+			}
+			c.add(loc, "密钥不可用["+key+"]："+err.Error())
+		}
+	}
+
+	for i := range server.Expect {
+		if err := server.Expect[i].validate(); err != nil {
+			c.add(loc+".expect["+strconv.Itoa(i)+"]", err.Error())
+		}
+	}
+
+	c.checkOptions(loc+".options", server.Options)
+}
+
+func (c *checker) checkOptions(loc string, options map[string]interface{}) {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		kind, ok := OptionSpecs[k]
+		if !ok {
+			c.add(loc, "未知选项："+k)
+			continue
+		}
+		if !kind.match(options[k]) {
+			c.add(loc+"."+k, fmt.Sprintf("类型错误，应为%s，实际值：%v", kind, options[k]))
+			continue
+		}
+		if k == "TerminalModes" {
+			for _, p := range checkTerminalModes(options[k]) {
+				c.add(loc+"."+k, p)
+			}
+		}
+		if k == "SetEnv" {
+			for _, p := range checkSetEnv(options[k]) {
+				c.add(loc+"."+k, p)
+			}
+		}
+		if k == "StrictHostKeyChecking" {
+			if p := checkHostKeyChecking(options[k]); p != "" {
+				c.add(loc+"."+k, p)
+			}
+		}
+	}
+}
+
+// 检查未知字段
+func (c *checker) checkRaw(raw map[string]interface{}) {
+	c.unknownFields("", raw, reflect.TypeOf(Config{}))
+	if m, ok := raw["log"].(map[string]interface{}); ok {
+		c.unknownFields("log", m, reflect.TypeOf(LogConfig{}))
+		if level, ok := m["level"].(string); ok {
+			if _, err := ParseLevel(level); err != nil {
+				c.add("log.level", err.Error())
+			}
+		}
+	}
+	if servers, ok := raw["servers"].([]interface{}); ok {
+		for i, s := range servers {
+			if m, ok := s.(map[string]interface{}); ok {
+				c.unknownFields("servers["+strconv.Itoa(i)+"]", m, reflect.TypeOf(Server{}))
+			}
+		}
+	}
+	c.rawGroups("", raw)
+}
+
+// 递归检查分组和子分组的未知字段
+func (c *checker) rawGroups(parent string, raw map[string]interface{}) {
+	groups, ok := raw["groups"].([]interface{})
+	if !ok {
+		return
+	}
+	for i, g := range groups {
+		m, ok := g.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		loc := "groups[" + strconv.Itoa(i) + "]"
+		if parent != "" {
+			loc = parent + "." + loc
+		}
+		c.unknownFields(loc, m, reflect.TypeOf(Group{}))
+		if servers, ok := m["servers"].([]interface{}); ok {
+			for j, s := range servers {
+				if m, ok := s.(map[string]interface{}); ok {
+					c.unknownFields(loc+".servers["+strconv.Itoa(j)+"]", m, reflect.TypeOf(Server{}))
+				}
+			}
+		}
+		c.rawGroups(loc, m)
+	}
+}
+
+func (c *checker) unknownFields(loc string, m map[string]interface{}, t reflect.Type) {
+	known := jsonFields(t)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !known[strings.ToLower(k)] {
+			if loc == "" {
+				c.add(k, "未知字段")
+			} else {
+				c.add(loc, "未知字段："+k)
+			}
+		}
+	}
+}
+
+// 结构体的json字段名（小写，json解析不区分大小写）
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+	return fields
+}
+
+// 计算json错误的行列位置
+func jsonErrorPos(b []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	} else {
+		return ""
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return ":" + strconv.Itoa(line) + ":" + strconv.Itoa(col)
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+
+	"gssh/core/scp"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//Client 服务器连接，可以在多个goroutine中同时执行命令和传输文件
+type Client struct {
+	*ssh.Client
+	server *Server
+}
+
+//Result 命令执行结果
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+	//ExitCode 远程命令的退出码
+	ExitCode int
+}
+
+//Dial 连接服务器，ctx取消或超时时停止连接
+func (server *Server) Dial(ctx context.Context) (*Client, error) {
+	client, err := server.GenClientContext(ctx)
+	AuditLogin(server, err)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client, server: server}, nil
+}
+
+//Server 连接的服务
+func (c *Client) Server() *Server {
+	return c.server
+}
+
+//FS 远程文件系统
+func (c *Client) FS() *RemoteFS {
+	return NewRemoteFS(c.Client)
+}
+
+//Run 执行命令，命令退出码不为0时不返回错误，通过Result.ExitCode判断
+//ctx取消或超时时结束远程命令，返回ctx的错误
+func (c *Client) Run(ctx context.Context, command string) (*Result, error) {
+	session, err := c.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	Log.Info("run cmd : ", command)
+	if err := session.Start(command); err != nil {
+		return nil, err
+	}
+
+	err = waitContext(ctx, session)
+
+	code := -1
+	var exitErr *ssh.ExitError
+	if err == nil {
+		code = 0
+	} else if errors.As(err, &exitErr) {
+		code = exitErr.ExitStatus()
+		err = nil
+	}
+	AuditCommand(c.server, command, code, err)
+	if err != nil {
+		// 取消后输出可能仍在写入，不再读取
+		return nil, err
+	}
+	return &Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: code}, nil
+}
+
+//Upload 上传本地文件或目录，remote为远程文件或目录的完整路径
+func (c *Client) Upload(local, remote string) error {
+	return c.UploadContext(context.Background(), local, remote)
+}
+
+//UploadContext 上传本地文件或目录，ctx取消或超时时中断传输并删除不完整的远程文件
+func (c *Client) UploadContext(ctx context.Context, local, remote string) error {
+	local, err := ParsePath(local)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	remote, err = c.FS().Realpath(remote)
+	if err != nil {
+		return err
+	}
+	s := scp.NewSCP(c.Client)
+	s.SetContext(ctx)
+	s.Warn = logSkipped
+	if fi.IsDir() {
+		err = s.SendDir(local, remote, nil)
+	} else {
+		err = s.SendFile(local, remote)
+	}
+	if err != nil {
+		s.RemovePartial()
+	}
+	AuditTransfer(c.server, "upload", local, remote, s.Transferred(), err)
+	return err
+}
+
+//Download 下载远程文件或目录，local为本地文件或目录的完整路径
+func (c *Client) Download(remote, local string) error {
+	return c.DownloadContext(context.Background(), remote, local)
+}
+
+//DownloadContext 下载远程文件或目录，ctx取消或超时时中断传输，不完整的本地文件会被删除
+func (c *Client) DownloadContext(ctx context.Context, remote, local string) error {
+	local, err := ParsePath(local)
+	if err != nil {
+		return err
+	}
+	fi, err := c.FS().Stat(remote)
+	if err != nil {
+		return err
+	}
+	s := scp.NewSCP(c.Client)
+	s.SetContext(ctx)
+	s.Warn = logSkipped
+	if fi.IsDir() {
+		err = s.ReceiveDir(fi.Path, local, nil)
+	} else {
+		err = s.ReceiveFile(fi.Path, local)
+	}
+	AuditTransfer(c.server, "download", remote, local, s.Transferred(), err)
+	return err
+}
+
+// 记录传输目录时跳过的特殊文件和符号链接循环
+func logSkipped(path string, err error) {
+	Log.Error("scp skip", path, err)
+}
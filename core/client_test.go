@@ -0,0 +1,30 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadCanceledKeepsFile(t *testing.T) {
+	ts, server := newTestServer(t)
+	client := dialTest(t, server)
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(local, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(ts.Dir, "a.txt")
+	if err := ioutil.WriteFile(remote, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.UploadContext(ctx, local, remote); err == nil {
+		t.Fatal("upload succeeded with a canceled context")
+	}
+	if data, err := ioutil.ReadFile(remote); err != nil || string(data) != "old" {
+		t.Fatalf("remote file = %q, %v", data, err)
+	}
+}
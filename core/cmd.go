@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,21 +10,29 @@ import (
 )
 
 type Cmd struct {
-	client  *ssh.Client
-	codes   []string
-	rtnCode int
-	rtnMsg  string
+	client   *ssh.Client
+	server   *Server
+	codes    []string
+	rtnCode  int
+	rtnMsg   string
+	exitCode int
 }
 
 func NewCmd(client *ssh.Client) *Cmd {
 	return &Cmd{
-		client:  client,
-		codes:   []string{},
-		rtnCode: -1,
-		rtnMsg:  "",
+		client:   client,
+		codes:    []string{},
+		rtnCode:  -1,
+		rtnMsg:   "",
+		exitCode: -1,
 	}
 }
 
+//SetServer 设置执行命令的服务，用于审计日志
+func (c *Cmd) SetServer(server *Server) {
+	c.server = server
+}
+
 func (c *Cmd) SetCmds(codes []string) {
 	c.codes = codes
 }
@@ -35,10 +44,20 @@ func (c *Cmd) AddCmd(code string) {
 	c.codes = append(c.codes, code)
 }
 
+//AddArgs 添加一条命令，参数会被转义，例如 AddArgs("mkdir", "-p", dir)
+func (c *Cmd) AddArgs(name string, args ...string) {
+	c.AddCmd(ShellCommand(name, args...))
+}
+
 func (c *Cmd) GetRtnCode() int {
 	return c.rtnCode
 }
 
+//GetExitCode 远程命令的退出码，未执行或没有退出码时为-1
+func (c *Cmd) GetExitCode() int {
+	return c.exitCode
+}
+
 func (c *Cmd) GetRtnMsg() string {
 	return c.rtnMsg
 }
@@ -51,10 +70,14 @@ func (c *Cmd) ResultMsg() string {
 }
 
 func (c *Cmd) Run() {
+	c.RunContext(context.Background())
+}
+
+//RunContext 执行命令，ctx取消或超时时结束远程命令
+func (c *Cmd) RunContext(ctx context.Context) {
 	session, err := c.client.NewSession()
 
 	if err != nil {
-		Errorln("create session fail:", err)
 		Log.Error("create session fail", err)
 		c.rtnCode = 12
 		c.rtnMsg = "create session fail!"
@@ -69,7 +92,16 @@ func (c *Cmd) Run() {
 	session.Stderr = &stderr
 	Log.Info("run cmd : ", cmd)
 
-	err = session.Run(cmd)
+	err = session.Start(cmd)
+	if err == nil {
+		err = waitContext(ctx, session)
+	}
+	if err == nil {
+		c.exitCode = 0
+	} else if exitErr, ok := err.(*ssh.ExitError); ok {
+		c.exitCode = exitErr.ExitStatus()
+	}
+	c.audit(cmd, err)
 	if err != nil {
 		Log.Error("run cmd fail", err)
 		c.rtnCode = 10
@@ -86,3 +118,47 @@ func (c *Cmd) Run() {
 	c.rtnCode = 0
 	c.rtnMsg = stdout.String()
 }
+
+func (c *Cmd) audit(cmd string, err error) {
+	server := c.server
+	if server == nil {
+		server = &Server{User: c.client.User(), IP: c.client.RemoteAddr().String()}
+	}
+	AuditCommand(server, cmd, c.exitCode, err)
+}
+
+//ShellCommand 拼接命令和参数，参数会被转义，可以安全地包含空格、引号和;等字符
+func ShellCommand(name string, args ...string) string {
+	words := make([]string, 0, len(args)+1)
+	words = append(words, name)
+	for _, arg := range args {
+		words = append(words, ShellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+//ShellQuote 转义shell参数，只包含安全字符时原样返回，否则用单引号包围
+func ShellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafeChars) == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%_+=:,./-"
+
+// 等待命令结束，ctx取消或超时时结束远程命令并关闭会话，返回ctx的错误
+func waitContext(ctx context.Context, session *ssh.Session) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return ctx.Err()
+	}
+}
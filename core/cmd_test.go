@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmdRun(t *testing.T) {
+	_, server := newTestServer(t)
+	client := dialTest(t, server)
+
+	c := NewCmd(client.Client)
+	c.AddCmd("cd /")
+	c.AddArgs("echo", "a b", "it's")
+	c.Run()
+	if c.GetRtnCode() != 0 || c.GetExitCode() != 0 {
+		t.Fatalf("rtnCode = %d, exitCode = %d, msg = %q", c.GetRtnCode(), c.GetExitCode(), c.GetRtnMsg())
+	}
+	if got := c.GetRtnMsg(); got != "a b it's\n" {
+		t.Fatalf("output = %q", got)
+	}
+}
+
+func TestCmdExitCode(t *testing.T) {
+	_, server := newTestServer(t)
+	client := dialTest(t, server)
+
+	c := NewCmd(client.Client)
+	c.AddCmd("exit 3")
+	c.Run()
+	if c.GetRtnCode() != 10 || c.GetExitCode() != 3 {
+		t.Fatalf("rtnCode = %d, exitCode = %d", c.GetRtnCode(), c.GetExitCode())
+	}
+
+	c = NewCmd(client.Client)
+	c.AddCmd("echo oops >&2")
+	c.Run()
+	if c.GetRtnCode() != 11 || c.GetRtnMsg() != "oops\n" {
+		t.Fatalf("rtnCode = %d, msg = %q", c.GetRtnCode(), c.GetRtnMsg())
+	}
+}
+
+func TestCmdRunContextCanceled(t *testing.T) {
+	_, server := newTestServer(t)
+	client := dialTest(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c := NewCmd(client.Client)
+	c.AddCmd("sleep 10")
+	c.RunContext(ctx)
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("command was not canceled")
+	}
+	if c.GetRtnCode() != 10 {
+		t.Fatalf("rtnCode = %d, msg = %q", c.GetRtnCode(), c.GetRtnMsg())
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	ts, server := newTestServer(t)
+	client := dialTest(t, server)
+
+	res, err := client.Run(context.Background(), "pwd; echo err >&2; exit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 2 || strings.TrimSpace(string(res.Stdout)) != ts.Dir || string(res.Stderr) != "err\n" {
+		t.Fatalf("result = %d %q %q", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	cmds := ts.Commands()
+	if len(cmds) != 1 || cmds[0] != "pwd; echo err >&2; exit 2" {
+		t.Fatalf("commands = %q", cmds)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"abc":        "abc",
+		"/a/b-c.txt": "/a/b-c.txt",
+		"":           "''",
+		"a b":        "'a b'",
+		"it's":       `'it'\''s'`,
+		"$HOME;rm":   "'$HOME;rm'",
+	}
+	for in, want := range tests {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,7 +2,8 @@ package core
 
 import "os"
 
-func ReadConfigPath(confStr string) string {
+//ReadConfigPath 配置文件路径，默认为程序目录下的al.conf，文件不存在时返回ErrConfigNotFound
+func ReadConfigPath(confStr string) (string, error) {
 	conf := ""
 	if confStr == "" {
 		tmp, _ := GetExecPath()
@@ -12,17 +13,13 @@ func ReadConfigPath(confStr string) string {
 	}
 	Log.Info("config path=", conf)
 
-	_, err := os.Stat(conf)
-	if err != nil {
+	if _, err := os.Stat(conf); err != nil {
+		Log.Error("config file stat fail", err)
 		if os.IsNotExist(err) {
-			Errorln("config file", conf+" not exists")
-			Log.Error("config file not exists")
-		} else {
-			Errorln("unknown error", err)
-			Log.Error("unknown error", err)
+			return conf, newError(ErrConfigNotFound, conf, nil)
 		}
-		os.Exit(0)
+		return conf, newError(ErrConfigNotFound, conf, err)
 	}
 
-	return conf
+	return conf, nil
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"errors"
 )
 
 var (
@@ -11,28 +12,31 @@ var (
 	StrKey = "#@!$%^&*SDcwSASAD!dd98"
 )
 
-func getKey() []byte {
+func getKey() ([]byte, error) {
 
 	keyLen := len(StrKey)
 	if keyLen < 16 {
-		panic("res key 长度不能小于16")
+		return nil, errors.New("res key 长度不能小于16")
 	}
 	arrKey := []byte(StrKey)
 	if keyLen >= 32 {
 		//取前32个字节
-		return arrKey[:32]
+		return arrKey[:32], nil
 	}
 	if keyLen >= 24 {
 		//取前24个字节
-		return arrKey[:24]
+		return arrKey[:24], nil
 	}
 	//取前16个字节
-	return arrKey[:16]
+	return arrKey[:16], nil
 }
 
 //Encrypt 加密字符串
 func Encrypt(strMesg string) (string, error) {
-	key := getKey()
+	key, err := getKey()
+	if err != nil {
+		return "", err
+	}
 	var iv = []byte(key)[:aes.BlockSize]
 	encrypted := make([]byte, len(strMesg))
 	aesBlockEncrypter, err := aes.NewCipher(key)
@@ -57,7 +61,10 @@ func Decrypt(src string) (strDesc string, err error) {
 	if err != nil {
 		return "", err
 	}
-	key := getKey()
+	key, err := getKey()
+	if err != nil {
+		return "", err
+	}
 	var iv = []byte(key)[:aes.BlockSize]
 	decrypted := make([]byte, len(srcByte))
 	var aesBlockDecrypter cipher.Block
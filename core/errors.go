@@ -0,0 +1,55 @@
+package core
+
+import "errors"
+
+// 错误类型，使用errors.Is判断，例如：errors.Is(err, core.ErrAuthFailed)
+var (
+	//ErrConfigNotFound 配置文件不存在
+	ErrConfigNotFound = errors.New("配置文件不存在")
+	//ErrConfigInvalid 配置文件格式或内容错误
+	ErrConfigInvalid = errors.New("配置文件错误")
+	//ErrServerNotFound 服务不存在
+	ErrServerNotFound = errors.New("服务不存在")
+	//ErrAuthFailed 密码或密钥错误
+	ErrAuthFailed = errors.New("鉴权失败")
+	//ErrHostUnreachable 无法连接服务器（网络不通、端口未开放、超时）
+	ErrHostUnreachable = errors.New("无法连接服务器")
+	//ErrHostKeyMismatch 服务器公钥与known_hosts中的记录不一致
+	ErrHostKeyMismatch = errors.New("服务器公钥不匹配")
+	//ErrHostKeyUnknown known_hosts中没有服务器公钥（StrictHostKeyChecking为yes时）
+	ErrHostKeyUnknown = errors.New("未知的服务器公钥")
+	//ErrConnectionLost 连接意外断开（网络中断、心跳超时）
+	ErrConnectionLost = errors.New("连接已断开")
+)
+
+//Error 带有服务名或文件路径的错误，Kind为上面的错误类型
+type Error struct {
+	Kind   error
+	Target string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	s := e.Kind.Error()
+	if e.Target != "" {
+		s += "[" + e.Target + "]"
+	}
+	if e.Err != nil {
+		s += "：" + e.Err.Error()
+	}
+	return s
+}
+
+//Unwrap 原始错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Is 判断错误类型
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func newError(kind error, target string, err error) error {
+	return &Error{Kind: kind, Target: target, Err: err}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const escapeHelp = `支持的转义命令（在行首输入）：
+ ~.  断开连接
+ ~C  打开命令行，添加端口转发：-L [bind:]port:host:hostport 或 -R [bind:]port:host:hostport
+ ~#  列出端口转发
+ ~s  连接统计
+ ~?  显示帮助
+ ~~  发送 ~
+`
+
+// 会话中的转义命令，处理键盘输入中行首的转义字符（默认~）
+type escapeReader struct {
+	r         io.Reader
+	char      byte
+	client    *ssh.Client
+	forwards  *forwards
+	out       io.Writer
+	start     time.Time
+	lineStart bool
+	closed    int32
+	pending   []byte
+	rest      []byte
+	err       error
+	// 统计输入输出字节数
+	in, output *int64
+}
+
+// 创建转义处理，EscapeChar为none时返回原输入
+func (server *Server) escapeReader(r io.Reader, client *ssh.Client, fw *forwards, out io.Writer, output *int64) io.Reader {
+	char := byte('~')
+	if c, ok := server.Options["EscapeChar"].(string); ok {
+		if c == "none" {
+			return r
+		}
+		if len(c) == 1 {
+			char = c[0]
+		}
+	}
+	return &escapeReader{
+		r:         r,
+		char:      char,
+		client:    client,
+		forwards:  fw,
+		out:       out,
+		start:     time.Now(),
+		lineStart: true,
+		in:        new(int64),
+		output:    output,
+	}
+}
+
+func (e *escapeReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.isClosed() {
+			return 0, io.EOF
+		}
+		if e.err != nil {
+			return 0, e.err
+		}
+		buf := make([]byte, len(p))
+		n, err := e.r.Read(buf)
+		e.pending = e.filter(buf[:n])
+		e.err = err
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	atomic.AddInt64(e.in, int64(n))
+	return n, nil
+}
+
+// 是否使用 ~. 断开了连接
+func (e *escapeReader) isClosed() bool {
+	return atomic.LoadInt32(&e.closed) == 1
+}
+
+// 过滤转义命令，返回需要发送的内容
+func (e *escapeReader) filter(b []byte) []byte {
+	e.rest = b
+	var out []byte
+	for len(e.rest) > 0 {
+		c := e.rest[0]
+		e.rest = e.rest[1:]
+		if !e.lineStart || c != e.char {
+			out = append(out, c)
+			e.lineStart = c == '\r' || c == '\n'
+			continue
+		}
+
+		// 行首的转义字符，读取下一个字符
+		next, ok := e.readByte()
+		if !ok {
+			return append(out, c)
+		}
+		if !e.command(next) {
+			if next != e.char {
+				out = append(out, c)
+			}
+			out = append(out, next)
+			e.lineStart = next == '\r' || next == '\n'
+		}
+		if e.isClosed() {
+			return out
+		}
+	}
+	return out
+}
+
+// 读取一个字符，先读取本次未处理的输入
+func (e *escapeReader) readByte() (byte, bool) {
+	if len(e.rest) > 0 {
+		c := e.rest[0]
+		e.rest = e.rest[1:]
+		return c, true
+	}
+	one := make([]byte, 1)
+	n, _ := e.r.Read(one)
+	return one[0], n == 1
+}
+
+// 执行转义命令，不是转义命令时返回false
+func (e *escapeReader) command(c byte) bool {
+	switch c {
+	case '.':
+		e.printf("\r\n[gssh] 断开连接\r\n")
+		atomic.StoreInt32(&e.closed, 1)
+		e.client.Close()
+	case '?':
+		e.printf("\r\n%s", strings.Replace(escapeHelp, "\n", "\r\n", -1))
+	case '#':
+		list := e.forwards.all()
+		e.printf("\r\n端口转发：%d个\r\n", len(list))
+		for _, f := range list {
+			conns, bytes := f.Stats()
+			e.printf("  %s  连接%d次，%d字节\r\n", f, conns, bytes)
+		}
+	case 's':
+		e.printf("\r\n%s@%s  已连接%s，发送%d字节，接收%d字节，端口转发%d个\r\n",
+			e.client.User(), e.client.RemoteAddr(), time.Since(e.start).Round(time.Second),
+			atomic.LoadInt64(e.in), atomic.LoadInt64(e.output), len(e.forwards.all()))
+	case 'C':
+		e.commandLine()
+	default:
+		return false
+	}
+	return true
+}
+
+// ~C 命令行，在raw模式下自行处理回显和退格
+func (e *escapeReader) commandLine() {
+	e.printf("\r\nssh> ")
+	var line []byte
+	for {
+		c, ok := e.readByte()
+		if !ok {
+			return
+		}
+		switch c {
+		case '\r', '\n':
+			e.printf("\r\n")
+			e.runLine(strings.TrimSpace(string(line)))
+			return
+		case 3, 27:
+			// Ctrl-C、Esc取消
+			e.printf("\r\n")
+			return
+		case 8, 127:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				e.printf("\b \b")
+			}
+		default:
+			if c >= 32 {
+				line = append(line, c)
+				e.printf("%c", c)
+			}
+		}
+	}
+}
+
+func (e *escapeReader) runLine(line string) {
+	if line == "" {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 1 && len(fields[0]) > 2 {
+		// 支持 -L8080:localhost:80 的写法
+		fields = []string{fields[0][:2], fields[0][2:]}
+	}
+	if len(fields) != 2 {
+		e.printf("命令格式错误，支持：-L [bind:]port:host:hostport、-R [bind:]port:host:hostport\r\n")
+		return
+	}
+	f, err := ParseForward(fields[0], fields[1])
+	if err == nil {
+		err = e.forwards.add(f)
+	}
+	if err != nil {
+		e.printf("添加端口转发失败：%v\r\n", err)
+		return
+	}
+	e.printf("已添加端口转发：%s\r\n", f)
+}
+
+func (e *escapeReader) printf(format string, a ...interface{}) {
+	fmt.Fprintf(e.out, format, a...)
+}
+
+// 统计写入的字节数
+type countWriter struct {
+	n *int64
+}
+
+func (w countWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(p)))
+	return len(p), nil
+}
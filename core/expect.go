@@ -0,0 +1,279 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// 等待提示的默认超时时间（秒）
+const defaultExpectTimeout = 10
+
+// 保留的输出长度，提示需要在这个长度内出现
+const expectBufferSize = 4096
+
+//ExpectRule 自动应答规则：输出匹配Pattern后发送Send
+type ExpectRule struct {
+	//Pattern 正则表达式，例如：[Pp]assword:
+	Pattern string `json:"pattern"`
+	//Send 发送的内容，自动加上回车
+	Send string `json:"send"`
+	//Encrypted Send是否使用 gal -e 加密
+	Encrypted bool `json:"encrypted,omitempty"`
+	//Timeout 等待提示的超时时间（秒），默认10秒，超时后停止自动应答，改为手动输入
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// 发送内容
+func (rule *ExpectRule) response() (string, error) {
+	if !rule.Encrypted {
+		return rule.Send, nil
+	}
+	return Decrypt(rule.Send)
+}
+
+func (rule *ExpectRule) timeout() time.Duration {
+	if rule.Timeout > 0 {
+		return time.Duration(rule.Timeout) * time.Second
+	}
+	return defaultExpectTimeout * time.Second
+}
+
+// 检查规则是否有效
+func (rule *ExpectRule) validate() error {
+	if rule.Pattern == "" {
+		return errors.New("缺少pattern")
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		return errors.New("pattern格式错误：" + err.Error())
+	}
+	if _, err := rule.response(); err != nil {
+		return errors.New("send无法解密：" + err.Error())
+	}
+	if rule.Timeout < 0 {
+		return errors.New("timeout无效：" + strconv.Itoa(rule.Timeout))
+	}
+	return nil
+}
+
+// 串行的自动应答：按顺序等待每条规则的提示，匹配后发送应答
+// 作为io.Writer接收终端输出，应答写入w
+type expecter struct {
+	mu     sync.Mutex
+	server string
+	rules  []ExpectRule
+	exps   []*regexp.Regexp
+	w      io.Writer
+	notice io.Writer
+	buf    []byte
+	next   int
+	timer  *time.Timer
+	done   chan struct{}
+}
+
+// 创建自动应答，w为远程输入，notice用于超时提示，可以为nil
+func newExpecter(server string, rules []ExpectRule, w, notice io.Writer) (*expecter, error) {
+	e := &expecter{
+		server: server,
+		rules:  rules,
+		w:      w,
+		notice: notice,
+		done:   make(chan struct{}),
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, errors.New("expect[" + strconv.Itoa(i) + "]" + err.Error())
+		}
+		e.exps = append(e.exps, regexp.MustCompile(rules[i].Pattern))
+	}
+	e.mu.Lock()
+	e.start()
+	e.mu.Unlock()
+	return e, nil
+}
+
+// 开始等待当前规则，全部完成后关闭done
+func (e *expecter) start() {
+	if e.next >= len(e.rules) {
+		e.finish()
+		return
+	}
+	rule := e.rules[e.next]
+	index := e.next
+	e.timer = time.AfterFunc(rule.timeout(), func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.next != index || e.isDone() {
+			return
+		}
+		Log.Error("expect timeout", e.server, rule.Pattern)
+		if e.notice != nil {
+			io.WriteString(e.notice, "\r\n[gssh] 等待 "+rule.Pattern+" 超时，请手动输入\r\n")
+		}
+		e.finish()
+	})
+}
+
+func (e *expecter) isDone() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *expecter) finish() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	if !e.isDone() {
+		close(e.done)
+	}
+}
+
+//Done 自动应答结束（全部匹配或超时）
+func (e *expecter) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *expecter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.isDone() {
+		return len(p), nil
+	}
+
+	e.buf = append(e.buf, p...)
+	for !e.isDone() {
+		loc := e.exps[e.next].FindIndex(e.buf)
+		if loc == nil {
+			break
+		}
+		e.buf = e.buf[loc[1]:]
+		e.timer.Stop()
+
+		rule := e.rules[e.next]
+		send, _ := rule.response()
+		Log.Info("expect matched", e.server, rule.Pattern)
+		if _, err := io.WriteString(e.w, send+"\n"); err != nil {
+			Log.Error("expect send fail", err)
+			e.finish()
+			break
+		}
+		e.next++
+		e.start()
+	}
+	if len(e.buf) > expectBufferSize {
+		e.buf = append([]byte(nil), e.buf[len(e.buf)-expectBufferSize:]...)
+	}
+	return len(p), nil
+}
+
+// 并发写入远程输入时加锁
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+func (l *lockedWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Close()
+}
+
+// 根据服务的expect规则创建自动应答，没有规则时返回nil
+func (server *Server) expecter(w, notice io.Writer) *expecter {
+	if len(server.Expect) == 0 {
+		return nil
+	}
+	e, err := newExpecter(server.Name, server.Expect, w, notice)
+	if err != nil {
+		Log.Error("自动应答配置错误", err)
+		return nil
+	}
+	return e
+}
+
+//RunPty 在终端（pty）中执行命令，按expect规则自动应答，返回远程退出码
+//out接收输出，in不为nil时转发为输入，用于自动应答超时后手动输入
+func (server *Server) RunPty(client *ssh.Client, command string, out io.Writer, in io.Reader) (int, error) {
+	return server.RunPtyContext(context.Background(), client, command, out, in)
+}
+
+//RunPtyContext 同RunPty，ctx取消或超时时结束远程命令并返回ctx的错误，之后out可能仍有写入
+func (server *Server) RunPtyContext(ctx context.Context, client *ssh.Client, command string, out io.Writer, in io.Reader) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	w := &lockedWriter{w: stdin}
+	// 没有手动输入时不提示超时，避免和输出并发写入
+	var notice io.Writer
+	if in != nil {
+		notice = out
+	}
+	session.Stdout = out
+	if e := server.expecter(w, notice); e != nil {
+		session.Stdout = io.MultiWriter(out, e)
+		defer e.finish()
+	}
+	session.Stderr = session.Stdout
+
+	server.sendEnv(session)
+	modes := server.terminalModes()
+	// 输出到终端时使用终端的大小并跟随变化
+	width, height := 80, 24
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd := int(f.Fd())
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+		stop := watchWindowSize(fd, width, height, func(w, h int) {
+			session.WindowChange(h, w)
+		})
+		defer stop()
+	}
+	if err := session.RequestPty(server.termType(), height, width, modes); err != nil {
+		return -1, err
+	}
+
+	Log.Info("run pty cmd : ", command)
+	if err := session.Start(command); err != nil {
+		return -1, err
+	}
+	if in != nil {
+		go io.Copy(w, in)
+	}
+
+	err = waitContext(ctx, session)
+	code := 0
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		code = exitErr.ExitStatus()
+		err = nil
+	} else if err != nil {
+		code = -1
+	}
+	AuditCommand(server, command, code, err)
+	return code, err
+}
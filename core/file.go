@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"os/user"
@@ -229,25 +228,29 @@ func FilesUnder(dirPath string) ([]string, error) {
 	return ret, nil
 }
 
-func MustOpenLogFile(fp string) *os.File {
+//OpenLogFile 以追加方式打开文件，目录不存在时创建
+func OpenLogFile(fp string) (*os.File, error) {
 	if strings.Contains(fp, "/") {
 		dir := Dir(fp)
 		err := EnsureDir(dir)
 		if err != nil {
-			log.Fatalf("mkdir -p %s occur error %v", dir, err)
+			return nil, fmt.Errorf("mkdir -p %s occur error %v", dir, err)
 		}
 	}
 
 	f, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		log.Fatalf("open %s occur error %v", fp, err)
+		return nil, fmt.Errorf("open %s occur error %v", fp, err)
 	}
 
-	return f
+	return f, nil
 }
 
 //ParsePath 解析路径
 func ParsePath(path string) (string, error) {
+	if path == "" {
+		return path, nil
+	}
 	str := []rune(path)
 	firstKey := string(str[:1])
 
@@ -260,6 +263,9 @@ func ParsePath(path string) (string, error) {
 		return home + string(str[1:]), nil
 	} else if firstKey == "." {
 		p, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+		if len(path) < 2 {
+			return p, nil
+		}
 		return p + "/" + path[2:], nil
 	} else {
 		return path, nil
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//Forward 端口转发
+type Forward struct {
+	//Remote 是否为远程转发（-R），否则为本地转发（-L）
+	Remote bool
+	//Listen 监听地址
+	Listen string
+	//Target 转发的目标地址
+	Target string
+
+	listener net.Listener
+	conns    int64
+	bytes    int64
+}
+
+//ParseForward 解析转发参数，格式同ssh：-L [bind:]port:host:hostport 或 -R [bind:]port:host:hostport
+func ParseForward(typ, spec string) (*Forward, error) {
+	f := &Forward{}
+	switch typ {
+	case "L", "-L":
+	case "R", "-R":
+		f.Remote = true
+	default:
+		return nil, errors.New("未知的转发类型：" + typ)
+	}
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		f.Listen = "localhost:" + parts[0]
+	case 4:
+		f.Listen = parts[0] + ":" + parts[1]
+		parts = parts[1:]
+	default:
+		return nil, errors.New("转发格式错误：" + spec)
+	}
+	for _, p := range []string{parts[0], parts[2]} {
+		if port, err := strconv.Atoi(p); err != nil || port <= 0 || port > 65535 {
+			return nil, errors.New("端口无效：" + p)
+		}
+	}
+	f.Target = parts[1] + ":" + parts[2]
+	return f, nil
+}
+
+func (f *Forward) String() string {
+	if f.Remote {
+		return "-R " + f.Listen + " -> " + f.Target
+	}
+	return "-L " + f.Listen + " -> " + f.Target
+}
+
+//Stats 连接数和传输的字节数
+func (f *Forward) Stats() (int64, int64) {
+	return atomic.LoadInt64(&f.conns), atomic.LoadInt64(&f.bytes)
+}
+
+// 一个ssh连接上的所有转发
+type forwards struct {
+	mu     sync.Mutex
+	client *ssh.Client
+	list   []*Forward
+}
+
+func newForwards(client *ssh.Client) *forwards {
+	return &forwards{client: client}
+}
+
+// 开始转发
+func (fs *forwards) add(f *Forward) error {
+	var err error
+	if f.Remote {
+		f.listener, err = fs.client.Listen("tcp", f.Listen)
+	} else {
+		f.listener, err = net.Listen("tcp", f.Listen)
+	}
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	fs.list = append(fs.list, f)
+	fs.mu.Unlock()
+	Log.Info("forward", f.String())
+
+	go func() {
+		for {
+			conn, err := f.listener.Accept()
+			if err != nil {
+				return
+			}
+			go fs.serve(f, conn)
+		}
+	}()
+	return nil
+}
+
+func (fs *forwards) serve(f *Forward, conn net.Conn) {
+	defer conn.Close()
+	var target net.Conn
+	var err error
+	if f.Remote {
+		target, err = net.Dial("tcp", f.Target)
+	} else {
+		target, err = fs.client.Dial("tcp", f.Target)
+	}
+	if err != nil {
+		Log.Error("forward dial fail", f.String(), err)
+		return
+	}
+	defer target.Close()
+
+	atomic.AddInt64(&f.conns, 1)
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		n, _ := io.Copy(dst, src)
+		atomic.AddInt64(&f.bytes, n)
+		done <- struct{}{}
+	}
+	go pipe(target, conn)
+	go pipe(conn, target)
+	<-done
+}
+
+// 当前的转发
+func (fs *forwards) all() []*Forward {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]*Forward(nil), fs.list...)
+}
+
+// 关闭所有转发
+func (fs *forwards) close() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, f := range fs.list {
+		f.listener.Close()
+	}
+	fs.list = nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+)
+
+// 回显服务，返回监听地址
+func echoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// 通过转发发送一行并读取回显
+func roundTrip(t *testing.T, addr string) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := io.WriteString(c, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("read = %q, %v", line, err)
+	}
+}
+
+func TestForwards(t *testing.T) {
+	_, server := newTestServer(t)
+	client := dialTest(t, server)
+	target := echoServer(t)
+
+	fs := newForwards(client.Client)
+	defer fs.close()
+	for _, remote := range []bool{false, true} {
+		f := &Forward{Remote: remote, Listen: "127.0.0.1:0", Target: target}
+		if err := fs.add(f); err != nil {
+			t.Fatal(f, err)
+		}
+		roundTrip(t, f.listener.Addr().String())
+		if conns, _ := f.Stats(); conns != 1 {
+			t.Errorf("%s conns = %d", f, conns)
+		}
+	}
+}
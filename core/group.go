@@ -0,0 +1,249 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+)
+
+//Group 分组，分组可以设置组内服务的默认值，也可以包含子分组
+//子分组的标识前缀为父分组前缀加上子分组前缀
+type Group struct {
+	GroupName string                 `json:"group_name"`
+	Prefix    string                 `json:"prefix"`
+	User      string                 `json:"user,omitempty"`
+	Port      int                    `json:"port,omitempty"`
+	Key       string                 `json:"key,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Jump      string                 `json:"jump,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Tags      map[string]string      `json:"tags,omitempty"`
+	Servers   []Server               `json:"servers"`
+	Groups    []Group                `json:"groups,omitempty"`
+}
+
+// 分组作用域，记录组合后的前缀、名称以及继承的默认值
+type groupScope struct {
+	group    *Group
+	prefix   string
+	title    string
+	loc      string
+	defaults Group
+}
+
+// 默认组
+var rootScope = &groupScope{}
+
+// 子分组作用域，子分组的默认值优先
+func (scope *groupScope) child(group *Group) *groupScope {
+	title := group.GroupName
+	if scope.title != "" {
+		title = scope.title + "/" + group.GroupName
+	}
+
+	d := scope.defaults
+	if group.User != "" {
+		d.User = group.User
+	}
+	if group.Port != 0 {
+		d.Port = group.Port
+	}
+	if group.Key != "" {
+		d.Key = group.Key
+	}
+	if group.Method != "" {
+		d.Method = group.Method
+	}
+	if group.Jump != "" {
+		d.Jump = group.Jump
+	}
+	d.Options = mergeMap(d.Options, group.Options)
+	d.Tags = mergeStringMap(d.Tags, group.Tags)
+
+	return &groupScope{
+		group:    group,
+		prefix:   scope.prefix + group.Prefix,
+		title:    title,
+		defaults: d,
+	}
+}
+
+// 按菜单顺序遍历分组（包含子分组）
+func walkGroups(groups []Group, parent *groupScope, fn func(scope *groupScope)) {
+	for i := range groups {
+		scope := parent.child(&groups[i])
+		scope.loc = "groups[" + strconv.Itoa(i) + "]"
+		if parent.loc != "" {
+			scope.loc = parent.loc + "." + scope.loc
+		}
+		fn(scope)
+		walkGroups(groups[i].Groups, scope, fn)
+	}
+}
+
+// 作用域内的服务列表
+func (scope *groupScope) servers(config *Config) []Server {
+	if scope.group == nil {
+		return config.Servers
+	}
+	return scope.group.Servers
+}
+
+// 按菜单顺序遍历配置中的服务
+func (app *App) eachServer(fn func(flag string, scope *groupScope, server *Server)) {
+	for i := range app.config.Servers {
+		fn(flagOf("", i), rootScope, &app.config.Servers[i])
+	}
+	walkGroups(app.config.Groups, rootScope, func(scope *groupScope) {
+		for j := range scope.group.Servers {
+			fn(flagOf(scope.prefix, j), scope, &scope.group.Servers[j])
+		}
+	})
+}
+
+// 按组合前缀查找分组作用域，空前缀为默认组
+func (app *App) findScope(prefix string) *groupScope {
+	if prefix == "" {
+		return rootScope
+	}
+	var found *groupScope
+	walkGroups(app.config.Groups, rootScope, func(scope *groupScope) {
+		if found == nil && scope.prefix == prefix {
+			found = scope
+		}
+	})
+	return found
+}
+
+// 按组合前缀查找分组
+func (app *App) findGroup(prefix string) (*Group, bool) {
+	scope := app.findScope(prefix)
+	if scope == nil || scope.group == nil {
+		return nil, false
+	}
+	return scope.group, true
+}
+
+// 查找分组所在的列表，用于删除
+func findGroupList(groups *[]Group, parent, prefix string) (*[]Group, int) {
+	for i := range *groups {
+		p := parent + (*groups)[i].Prefix
+		if p == prefix {
+			return groups, i
+		}
+		if list, j := findGroupList(&(*groups)[i].Groups, p, prefix); list != nil {
+			return list, j
+		}
+	}
+	return nil, -1
+}
+
+// 合并分组默认值和全局选项，生成实际使用的服务，不修改配置
+func (server *Server) resolve(scope *groupScope, options map[string]interface{}) *Server {
+	s := *server
+	d := scope.defaults
+	if s.User == "" {
+		s.User = d.User
+	}
+	if s.Port == 0 {
+		s.Port = d.Port
+	}
+	if s.Key == "" {
+		s.Key = d.Key
+	}
+	if s.Method == "" {
+		s.Method = d.Method
+	}
+	if s.Jump == "" {
+		s.Jump = d.Jump
+	}
+	s.Options = mergeMap(nil, server.Options)
+	s.MergeOptions(d.Options, false)
+	s.MergeOptions(options, false)
+	s.Tags = mergeStringMap(nil, server.Tags)
+	s.group = scope.title
+	s.groupTags = d.Tags
+	s.Format()
+	return &s
+}
+
+// 为服务关联跳板机，并检查循环引用
+func (app *App) linkJumps() error {
+	for _, index := range app.serverIndex {
+		server := index.server
+		if server.Jump == "" {
+			continue
+		}
+		jump := app.findByName(server.Jump)
+		if jump == nil {
+			return errors.New("服务[" + server.Name + "]的跳板机不存在：" + server.Jump)
+		}
+		server.jump = jump
+	}
+
+	for _, index := range app.serverIndex {
+		seen := map[*Server]bool{}
+		for s := index.server; s != nil; s = s.jump {
+			if seen[s] {
+				return errors.New("服务[" + index.server.Name + "]的跳板机存在循环引用")
+			}
+			seen[s] = true
+		}
+	}
+	return nil
+}
+
+// 按名称查找服务（已合并默认值）
+func (app *App) findByName(name string) *Server {
+	var found *Server
+	app.eachServer(func(flag string, scope *groupScope, server *Server) {
+		if found == nil && server.Name == name {
+			if index, ok := app.serverIndex[flag]; ok {
+				found = index.server
+			}
+		}
+	})
+	return found
+}
+
+func mergeMap(base, over map[string]interface{}) map[string]interface{} {
+	if base == nil && over == nil {
+		return nil
+	}
+	m := make(map[string]interface{})
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range over {
+		m[k] = v
+	}
+	return m
+}
+
+func mergeStringMap(base, over map[string]string) map[string]string {
+	if base == nil && over == nil {
+		return nil
+	}
+	m := make(map[string]string)
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range over {
+		m[k] = v
+	}
+	return m
+}
+
+// 服务在列表中的下标
+func indexOf(list []Server, server *Server) int {
+	for i := range list {
+		if &list[i] == server {
+			return i
+		}
+	}
+	return -1
+}
+
+// 菜单标识
+func flagOf(prefix string, i int) string {
+	return prefix + strconv.Itoa(i+1)
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// StrictHostKeyChecking的取值
+const (
+	hostKeyYes       = "yes"
+	hostKeyAcceptNew = "accept-new"
+	hostKeyNo        = "no"
+)
+
+// 检查StrictHostKeyChecking选项
+func checkHostKeyChecking(v interface{}) string {
+	switch v.(string) {
+	case hostKeyYes, hostKeyAcceptNew, hostKeyNo:
+		return ""
+	}
+	return "应为yes、accept-new或no"
+}
+
+// known_hosts文件，默认~/.ssh/known_hosts
+func (server *Server) knownHostsFile() (string, error) {
+	file, _ := server.Options["UserKnownHostsFile"].(string)
+	if file == "" {
+		file = "~/.ssh/known_hosts"
+	}
+	return ParsePath(file)
+}
+
+// 服务器公钥检查，由StrictHostKeyChecking选项控制：
+// yes：只接受known_hosts中的公钥；accept-new：新服务器的公钥写入known_hosts，公钥变化时拒绝；no（默认）：不检查
+// 握手失败时ssh返回的错误丢失了类型，检查失败的错误记录到keyErr
+func (server *Server) hostKeyCallback(keyErr *error) (ssh.HostKeyCallback, error) {
+	mode, _ := server.Options["StrictHostKeyChecking"].(string)
+	if mode == "" || mode == hostKeyNo {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	file, err := server.knownHostsFile()
+	if err != nil {
+		return nil, err
+	}
+	check := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return &knownhosts.KeyError{}
+	}
+	if IsExist(file) {
+		if check, err = knownhosts.New(file); err != nil {
+			return nil, errors.New("读取known_hosts失败：" + err.Error())
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var ke *knownhosts.KeyError
+		if err == nil || !errors.As(err, &ke) {
+			return err
+		}
+		if len(ke.Want) > 0 {
+			*keyErr = newError(ErrHostKeyMismatch, hostname, errors.New(file+"中记录的公钥与服务器不一致，指纹："+ssh.FingerprintSHA256(key)))
+			return *keyErr
+		}
+		if mode != hostKeyAcceptNew {
+			*keyErr = newError(ErrHostKeyUnknown, hostname, errors.New("指纹："+ssh.FingerprintSHA256(key)))
+			return *keyErr
+		}
+		Log.Info("add host key", hostname, ssh.FingerprintSHA256(key))
+		return appendKnownHost(file, hostname, key)
+	}, nil
+}
+
+// 新服务器的公钥写入known_hosts
+func appendKnownHost(file, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+	return err
+}
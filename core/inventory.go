@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+//Inventory 服务清单：配置文件只加载一次，之后的查找和连接不再读取文件，可以在多个goroutine中使用
+type Inventory struct {
+	mu   sync.RWMutex
+	path string
+	app  *App
+}
+
+//LoadInventory 加载配置文件，path为空时使用程序目录下的al.conf
+func LoadInventory(path string) (*Inventory, error) {
+	path, err := ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{path: path}
+	if err := inv.Reload(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+//Path 配置文件路径
+func (inv *Inventory) Path() string {
+	return inv.path
+}
+
+//Reload 重新加载配置文件，失败时继续使用之前加载的服务
+func (inv *Inventory) Reload() error {
+	app := &App{ConfigPath: inv.path}
+	if err := app.Load(); err != nil {
+		return err
+	}
+	inv.mu.Lock()
+	inv.app = app
+	inv.mu.Unlock()
+	return nil
+}
+
+//Servers 所有服务（已合并分组默认值），按菜单顺序
+func (inv *Inventory) Servers() []*Server {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	var servers []*Server
+	inv.app.eachServer(func(flag string, scope *groupScope, conf *Server) {
+		servers = append(servers, inv.app.serverIndex[flag].server.clone())
+	})
+	return servers
+}
+
+//Server 按名称查找服务，不存在时返回ErrServerNotFound
+func (inv *Inventory) Server(name string) (*Server, error) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	if server := inv.app.findByName(name); server != nil {
+		return server.clone(), nil
+	}
+	return nil, newError(ErrServerNotFound, name, nil)
+}
+
+//ServerByFlag 按菜单标识查找服务，例如：1、p2，不存在时返回ErrServerNotFound
+func (inv *Inventory) ServerByFlag(flag string) (*Server, error) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	if server, ok := inv.app.ServerByFlag(flag); ok {
+		return server.clone(), nil
+	}
+	return nil, newError(ErrServerNotFound, flag, nil)
+}
+
+//Select 按标签选择服务，格式同 gal -s，例如：role=db,env!=prod，没有匹配时返回空列表
+func (inv *Inventory) Select(selector string) ([]*Server, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	servers := []*Server{}
+	inv.app.eachServer(func(flag string, scope *groupScope, conf *Server) {
+		if server := inv.app.serverIndex[flag].server; sel.MatchServer(server) {
+			servers = append(servers, server.clone())
+		}
+	})
+	return servers, nil
+}
+
+//Dial 按名称连接服务器，ctx取消或超时时停止连接
+func (inv *Inventory) Dial(ctx context.Context, name string) (*Client, error) {
+	server, err := inv.Server(name)
+	if err != nil {
+		return nil, err
+	}
+	return server.Dial(ctx)
+}
+
+// 复制服务，调用方修改选项、标签不影响清单中的服务
+func (server *Server) clone() *Server {
+	s := *server
+	s.Options = mergeMap(nil, server.Options)
+	s.Tags = mergeStringMap(nil, server.Tags)
+	s.Expect = append([]ExpectRule(nil), server.Expect...)
+	s.recorder = nil
+	return &s
+}
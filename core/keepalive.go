@@ -0,0 +1,89 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ServerAliveCountMax的默认值，同ssh
+const defaultAliveCountMax = 3
+
+// 心跳检测，按ServerAliveInterval发送keepalive@openssh.com，
+// 连续ServerAliveCountMax次没有回应时认为连接已断开并关闭连接
+type keepAlive struct {
+	stopOnce sync.Once
+	done     chan struct{}
+	dead     int32
+}
+
+// 开始心跳，没有设置ServerAliveInterval时不发送
+func (server *Server) startKeepAlive(client *ssh.Client) *keepAlive {
+	k := &keepAlive{done: make(chan struct{})}
+	interval, _ := server.Options["ServerAliveInterval"].(float64)
+	if interval <= 0 {
+		return k
+	}
+	countMax := defaultAliveCountMax
+	if n, ok := server.Options["ServerAliveCountMax"].(float64); ok && n > 0 {
+		countMax = int(n)
+	}
+
+	d := time.Duration(interval * float64(time.Second))
+	go func() {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		missed := 0
+		for {
+			select {
+			case <-k.done:
+				return
+			case <-ticker.C:
+			}
+
+			if k.ping(client, d) {
+				missed = 0
+				continue
+			}
+			missed++
+			Log.Error("keepalive no reply", server.Name, missed)
+			if missed >= countMax {
+				Log.Error("keepalive timeout, close connection", server.Name)
+				atomic.StoreInt32(&k.dead, 1)
+				client.Close()
+				return
+			}
+		}
+	}()
+	return k
+}
+
+// 发送一次心跳，在timeout内收到回应（包括失败回应）返回true
+func (k *keepAlive) ping(client *ssh.Client, timeout time.Duration) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	case <-k.done:
+		return true
+	}
+}
+
+// 连接是否因为没有心跳回应而关闭
+func (k *keepAlive) isDead() bool {
+	return atomic.LoadInt32(&k.dead) == 1
+}
+
+func (k *keepAlive) stop() {
+	k.stopOnce.Do(func() {
+		close(k.done)
+	})
+}
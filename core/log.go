@@ -1,76 +1,317 @@
 package core
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-type logger struct {
-	File  string
-	level string
+//Level 日志级别
+type Level int
+
+//Level 枚举类型
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	default:
+		return "error"
+	}
+}
+
+//ParseLevel 解析日志级别：debug、info、error
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, errors.New("未知的日志级别：" + s)
+}
+
+//Fields 日志的结构化字段
+type Fields map[string]interface{}
+
+//LogConfig 日志配置，对应配置文件中的log
+type LogConfig struct {
+	//File 日志文件，默认为程序目录下的 程序名.log
+	File string `json:"file,omitempty"`
+	//Level 日志级别，默认info
+	Level string `json:"level,omitempty"`
+	//AuditFile 审计日志文件，默认为程序目录下的 程序名.audit.log
+	AuditFile string `json:"audit_file,omitempty"`
+	//MaxSize 单个日志文件的最大大小（MB），超过后切分，0为不切分
+	MaxSize int `json:"max_size,omitempty"`
+	//MaxAge 切分后的日志保留天数，0为不限制
+	MaxAge int `json:"max_age,omitempty"`
+	//MaxBackups 切分后的日志保留个数，0为不限制
+	MaxBackups int `json:"max_backups,omitempty"`
+}
+
+//Logger 结构化日志，每行一个json对象，可以在多个goroutine中使用
+type Logger struct {
+	mu         sync.Mutex
+	file       string
+	level      Level
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	f          *os.File
+	size       int64
 }
 
 //Log 全局log
-var Log logger
+var Log = NewLogger(defaultLogFile(".log"))
+
+//Audit 审计日志，记录登录、命令执行和文件传输
+var Audit = NewLogger(defaultLogFile(".audit.log"))
 
-func init() {
+// 程序目录下的 程序名+后缀
+func defaultLogFile(suffix string) string {
 	path, _ := GetExecPath()
 	_, fn := filepath.Split(os.Args[0])
 	if fn == "" {
-		fn = "gssh.log"
-	} else {
-		fn = fn + ".log"
+		fn = "gssh"
 	}
-	logFile, _ := ParsePath(path + fn)
-	Log = logger{
-		File: logFile,
+	fn = strings.TrimSuffix(fn, ".exe")
+	logFile, _ := ParsePath(path + fn + suffix)
+	return logFile
+}
+
+//NewLogger 创建日志，文件在第一次写入时打开
+func NewLogger(file string) *Logger {
+	return &Logger{
+		file:  file,
+		level: LevelInfo,
 	}
 }
 
-func (logger *logger) write(msg ...interface{}) {
-	if _, err := os.Stat(logger.File); err != nil {
-		if os.IsNotExist(err) {
-			_, err := os.Create(logger.File)
-			if err != nil {
-				panic(err)
-			}
-		} else {
-			panic(err)
+//ConfigureLog 按配置设置Log和Audit
+func ConfigureLog(conf *LogConfig) error {
+	if conf == nil {
+		return nil
+	}
+	level, err := ParseLevel(conf.Level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(level)
+
+	maxSize := int64(conf.MaxSize) * 1024 * 1024
+	maxAge := time.Duration(conf.MaxAge) * 24 * time.Hour
+	for _, item := range []struct {
+		logger *Logger
+		file   string
+	}{{Log, conf.File}, {Audit, conf.AuditFile}} {
+		item.logger.SetRotate(maxSize, maxAge, conf.MaxBackups)
+		if item.file == "" {
+			continue
+		}
+		file, err := ParsePath(item.file)
+		if err != nil {
+			return err
+		}
+		item.logger.SetFile(file)
+	}
+	return nil
+}
+
+//File 日志文件路径
+func (l *Logger) File() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file
+}
+
+//SetFile 修改日志文件，之后的日志写入新文件
+func (l *Logger) SetFile(file string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file == l.file {
+		return
+	}
+	l.close()
+	l.file = file
+}
+
+//SetLevel 修改日志级别
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
+//SetRotate 设置切分：maxSize为字节数，maxAge和maxBackups为切分后文件的保留时间和个数，0为不限制
+func (l *Logger) SetRotate(maxSize int64, maxAge time.Duration, maxBackups int) {
+	l.mu.Lock()
+	l.maxSize = maxSize
+	l.maxAge = maxAge
+	l.maxBackups = maxBackups
+	l.mu.Unlock()
+}
+
+//Close 关闭日志文件
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.close()
+}
+
+//Debug 调试日志
+func (l *Logger) Debug(msg ...interface{}) {
+	l.Log(LevelDebug, sprint(msg...), nil)
+}
+
+//Info 普通日志
+func (l *Logger) Info(msg ...interface{}) {
+	l.Log(LevelInfo, sprint(msg...), nil)
+}
+
+//Error 错误日志
+func (l *Logger) Error(msg ...interface{}) {
+	l.Log(LevelError, sprint(msg...), nil)
+}
+
+//Log 写入一行日志，fields为附加字段
+func (l *Logger) Log(level Level, msg string, fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+
+	line := encodeLine(level, msg, fields)
+	if err := l.open(); err != nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return
 		}
 	}
+	n, _ := l.f.Write(line)
+	l.size += int64(n)
+}
+
+func sprint(msg ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(msg...), "\n")
+}
+
+// 生成json行，time、level、msg在前，其余字段按名称排序
+func encodeLine(level Level, msg string, fields Fields) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, time.Now().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, msg)
 
-	logFile, err := os.OpenFile(logger.File, os.O_RDWR|os.O_APPEND, 0666)
-	defer func() {
-		if logFile != nil {
-			logFile.Close()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeJSON(&buf, k)
+		buf.WriteByte(':')
+		v := fields[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
 		}
-	}()
-	if err != nil {
-		panic(err)
+		writeJSON(&buf, v)
 	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
 
-	// 创建一个日志对象
-	l := log.New(logFile, logger.level, log.LstdFlags)
-	l.Println(msg...)
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
 }
 
-// func (logger *logger) Category(category string) *logger {
-// 	logger.category = category
-// 	return logger
-// }
+func (l *Logger) open() error {
+	if l.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.file), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.size = 0
+	if fi, err := f.Stat(); err == nil {
+		l.size = fi.Size()
+	}
+	l.f = f
+	return nil
+}
 
-func (logger *logger) Debug(msg ...interface{}) {
-	logger.level = "[D]"
-	logger.write(msg...)
+func (l *Logger) close() error {
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
 }
 
-func (logger *logger) Info(msg ...interface{}) {
-	logger.level = "[I]"
-	logger.write(msg...)
+// 切分日志：当前文件改名为 文件名.时间，再清理过期的文件
+func (l *Logger) rotate() error {
+	l.close()
+	base := l.file + "." + time.Now().Format("20060102150405.000")
+	backup := base
+	for i := 1; IsExist(backup); i++ {
+		backup = base + "-" + strconv.Itoa(i)
+	}
+	if err := os.Rename(l.file, backup); err != nil {
+		return err
+	}
+	l.prune()
+	return l.open()
 }
 
-func (logger *logger) Error(msg ...interface{}) {
-	logger.level = "[E]"
-	logger.write(msg...)
+func (l *Logger) prune() {
+	if l.maxAge <= 0 && l.maxBackups <= 0 {
+		return
+	}
+	backups, _ := filepath.Glob(l.file + ".*")
+	// 文件名中的时间保证按名称排序即按时间排序
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		expired := l.maxBackups > 0 && i >= l.maxBackups
+		if !expired && l.maxAge > 0 {
+			if fi, err := os.Stat(backup); err == nil && time.Since(fi.ModTime()) > l.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
 }
@@ -0,0 +1,354 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//GroupEntry 分组列表条目
+type GroupEntry struct {
+	//Prefix 组合前缀
+	Prefix string `json:"prefix"`
+	//Title 分组名称，子分组为 父分组/子分组
+	Title string `json:"title"`
+}
+
+//ServerEntry 服务列表条目
+type ServerEntry struct {
+	Flag   string            `json:"flag"`
+	Group  string            `json:"group"`
+	Prefix string            `json:"prefix"`
+	Name   string            `json:"name"`
+	IP     string            `json:"ip"`
+	Port   int               `json:"port"`
+	User   string            `json:"user"`
+	Method string            `json:"method"`
+	Key    string            `json:"key"`
+	Jump   string            `json:"jump,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// 按名称查找服务，返回所在的服务列表和下标
+func (app *App) findServer(name string) (*[]Server, int) {
+	var list *[]Server
+	index := -1
+	app.eachServer(func(flag string, scope *groupScope, server *Server) {
+		if list != nil || server.Name != name {
+			return
+		}
+		list = &app.config.Servers
+		if scope.group != nil {
+			list = &scope.group.Servers
+		}
+		index = indexOf(*list, server)
+	})
+	return list, index
+}
+
+//ListServers 列出满足选择条件的服务（已合并分组默认值），sel为nil时列出所有服务
+func (app *App) ListServers(sel *Selector) ([]ServerEntry, error) {
+	if err := app.loadConfig(); err != nil {
+		return nil, err
+	}
+	app.serverIndex = make(map[string]ServerIndex)
+	app.loadServerMap(false)
+
+	entries := []ServerEntry{}
+	app.eachServer(func(flag string, scope *groupScope, conf *Server) {
+		s := app.serverIndex[flag].server
+		if !sel.MatchServer(s) {
+			return
+		}
+		e := ServerEntry{
+			Flag:   flag,
+			Group:  scope.title,
+			Prefix: scope.prefix,
+			Name:   s.Name,
+			IP:     s.IP,
+			Port:   s.Port,
+			User:   s.User,
+			Method: s.Method,
+			Key:    s.Key,
+			Jump:   s.Jump,
+		}
+		if labels := s.Labels(); len(labels) > 0 {
+			e.Tags = labels
+		}
+		entries = append(entries, e)
+	})
+	return entries, nil
+}
+
+//ListGroups 按菜单顺序列出所有分组（不包含默认组）
+func (app *App) ListGroups() ([]GroupEntry, error) {
+	if err := app.loadConfig(); err != nil {
+		return nil, err
+	}
+	groups := []GroupEntry{}
+	walkGroups(app.config.Groups, rootScope, func(scope *groupScope) {
+		groups = append(groups, GroupEntry{Prefix: scope.prefix, Title: scope.title})
+	})
+	return groups, nil
+}
+
+//AddServer 新增服务，prefix为空时加入默认组
+func (app *App) AddServer(prefix string, server Server) error {
+	if err := app.loadConfig(); err != nil {
+		return err
+	}
+	if server.Name == "" || server.IP == "" {
+		return errors.New("name、ip不能为空")
+	}
+	if list, _ := app.findServer(server.Name); list != nil {
+		return errors.New("服务已存在：" + server.Name)
+	}
+	if err := validServer(&server); err != nil {
+		return err
+	}
+
+	scope := app.findScope(prefix)
+	if scope == nil {
+		return errors.New("分组不存在：" + prefix)
+	}
+	if server.User == "" && scope.defaults.User == "" {
+		return errors.New("user不能为空（分组未设置默认用户）")
+	}
+	if scope.group == nil {
+		app.config.Servers = append(app.config.Servers, server)
+	} else {
+		scope.group.Servers = append(scope.group.Servers, server)
+	}
+	return app.saveConfig()
+}
+
+//SetServer 修改服务字段，key支持name、ip、port、user、password、method、key、jump、group以及options.名称、tags.名称
+//password为明文，保存时加密；options的值为空时删除该选项
+func (app *App) SetServer(name string, values map[string]string) error {
+	if err := app.loadConfig(); err != nil {
+		return err
+	}
+	list, i := app.findServer(name)
+	if list == nil {
+		return newError(ErrServerNotFound, name, nil)
+	}
+	server := (*list)[i]
+
+	group, moved := "", false
+	for k, v := range values {
+		switch strings.ToLower(k) {
+		case "name":
+			if v != name {
+				if l, _ := app.findServer(v); l != nil {
+					return errors.New("服务已存在：" + v)
+				}
+			}
+			server.Name = v
+		case "ip":
+			server.IP = v
+		case "port":
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.New("端口无效：" + v)
+			}
+			server.Port = port
+		case "user":
+			server.User = v
+		case "password":
+			if v != "" {
+				p, err := Encrypt(v)
+				if err != nil {
+					return err
+				}
+				v = p
+			}
+			server.Password = v
+		case "method":
+			server.Method = v
+		case "key":
+			server.Key = v
+		case "jump":
+			server.Jump = v
+		case "group":
+			group, moved = v, true
+		default:
+			if strings.HasPrefix(k, "tags.") {
+				server.setTag(strings.TrimPrefix(k, "tags."), v)
+				continue
+			}
+			if !strings.HasPrefix(k, "options.") {
+				return errors.New("未知字段：" + k)
+			}
+			if err := server.setOption(strings.TrimPrefix(k, "options."), v); err != nil {
+				return err
+			}
+		}
+	}
+	if err := validServer(&server); err != nil {
+		return err
+	}
+
+	if !moved {
+		(*list)[i] = server
+		return app.saveConfig()
+	}
+
+	var target *[]Server
+	if group == "" {
+		target = &app.config.Servers
+	} else {
+		g, ok := app.findGroup(group)
+		if !ok {
+			return errors.New("分组不存在：" + group)
+		}
+		target = &g.Servers
+	}
+	*list = append((*list)[:i], (*list)[i+1:]...)
+	*target = append(*target, server)
+	return app.saveConfig()
+}
+
+//RemoveServer 删除服务
+func (app *App) RemoveServer(name string) error {
+	if err := app.loadConfig(); err != nil {
+		return err
+	}
+	list, i := app.findServer(name)
+	if list == nil {
+		return newError(ErrServerNotFound, name, nil)
+	}
+	*list = append((*list)[:i], (*list)[i+1:]...)
+	return app.saveConfig()
+}
+
+//AddGroup 新增分组，parent为父分组的组合前缀（为空时新增顶层分组），tags为组内服务继承的标签
+func (app *App) AddGroup(parent, name, prefix string, tags map[string]string) error {
+	if err := app.loadConfig(); err != nil {
+		return err
+	}
+	if name == "" || prefix == "" {
+		return errors.New("分组名称和前缀不能为空")
+	}
+	if _, err := strconv.Atoi(prefix[len(prefix)-1:]); err == nil {
+		return errors.New("分组前缀不能以数字结尾：" + prefix)
+	}
+	if _, ok := app.findGroup(parent + prefix); ok {
+		return errors.New("分组前缀已存在：" + parent + prefix)
+	}
+	groups := &app.config.Groups
+	if parent != "" {
+		p, ok := app.findGroup(parent)
+		if !ok {
+			return errors.New("父分组不存在：" + parent)
+		}
+		groups = &p.Groups
+	}
+	*groups = append(*groups, Group{
+		GroupName: name,
+		Prefix:    prefix,
+		Servers:   []Server{},
+		Tags:      tags,
+	})
+	return app.saveConfig()
+}
+
+//RemoveGroup 删除分组（组合前缀），分组不为空时需要force
+func (app *App) RemoveGroup(prefix string, force bool) error {
+	if err := app.loadConfig(); err != nil {
+		return err
+	}
+	list, i := findGroupList(&app.config.Groups, "", prefix)
+	if list == nil {
+		return errors.New("分组不存在：" + prefix)
+	}
+	group := (*list)[i]
+	if (len(group.Servers) > 0 || len(group.Groups) > 0) && !force {
+		return errors.New("分组不为空，共" + strconv.Itoa(len(group.Servers)) + "个服务、" + strconv.Itoa(len(group.Groups)) + "个子分组")
+	}
+	*list = append((*list)[:i], (*list)[i+1:]...)
+	return app.saveConfig()
+}
+
+//ParseTags 解析标签，格式：key=value,key2=value2
+func ParseTags(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, errors.New("标签格式错误，应为key=value：" + kv)
+		}
+		tags[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return tags, nil
+}
+
+// 校验服务字段
+func validServer(server *Server) error {
+	if server.Name == "" {
+		return errors.New("name不能为空")
+	}
+	if server.Port < 0 || server.Port > 65535 {
+		return errors.New("端口无效：" + strconv.Itoa(server.Port))
+	}
+	if server.Method != "" && !methods[server.Method] {
+		return errors.New("未知的method：" + server.Method)
+	}
+	return nil
+}
+
+// 设置标签，值为空时删除
+func (server *Server) setTag(name, value string) {
+	if value == "" {
+		delete(server.Tags, name)
+		return
+	}
+	if server.Tags == nil {
+		server.Tags = make(map[string]string)
+	}
+	server.Tags[name] = value
+}
+
+// 按选项类型解析并设置选项值，值为空时删除
+func (server *Server) setOption(name, value string) error {
+	kind, ok := OptionSpecs[name]
+	if !ok {
+		return errors.New("未知选项：" + name)
+	}
+	if value == "" {
+		delete(server.Options, name)
+		return nil
+	}
+
+	var v interface{}
+	switch kind {
+	case OptionNumber:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("选项" + name + "应为数字：" + value)
+		}
+		v = f
+	case OptionBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("选项" + name + "应为true/false：" + value)
+		}
+		v = b
+	case OptionString:
+		v = value
+	default:
+		// 列表和map使用json格式
+		if err := json.Unmarshal([]byte(value), &v); err != nil || !kind.match(v) {
+			return errors.New("选项" + name + "应为json格式的" + kind.String() + "：" + value)
+		}
+	}
+
+	if server.Options == nil {
+		server.Options = make(map[string]interface{})
+	}
+	server.Options[name] = v
+	return nil
+}
@@ -0,0 +1,106 @@
+package core
+
+//OptionKind 选项值类型
+type OptionKind int
+
+//OptionKind 枚举类型
+const (
+	OptionNumber OptionKind = iota
+	OptionString
+	OptionBool
+	OptionStringList
+	OptionStringMap
+	OptionNumberMap
+)
+
+func (k OptionKind) String() string {
+	switch k {
+	case OptionNumber:
+		return "number"
+	case OptionString:
+		return "string"
+	case OptionBool:
+		return "bool"
+	case OptionStringList:
+		return "string list"
+	case OptionStringMap:
+		return "string map"
+	case OptionNumberMap:
+		return "number map"
+	default:
+		return "unknown"
+	}
+}
+
+//OptionSpecs 支持的选项及其类型，新增选项需要在这里登记
+var OptionSpecs = map[string]OptionKind{
+	"ConnectTimeout":        OptionNumber,
+	"ServerAliveInterval":   OptionNumber,
+	"ServerAliveCountMax":   OptionNumber,
+	"AutoReconnect":         OptionBool,
+	"ReconnectAttempts":     OptionNumber,
+	"Record":                OptionBool,
+	"RecordDir":             OptionString,
+	"RecordInput":           OptionBool,
+	"RemoteCommand":         OptionString,
+	"StartupCommands":       OptionStringList,
+	"SetEnv":                OptionStringMap,
+	"EscapeChar":            OptionString,
+	"Term":                  OptionString,
+	"TerminalModes":         OptionNumberMap,
+	"SendEnv":               OptionStringList,
+	"ForwardAgent":          OptionBool,
+	"ForwardX11":            OptionBool,
+	"StrictHostKeyChecking": OptionString,
+	"UserKnownHostsFile":    OptionString,
+}
+
+// 判断选项值类型是否正确（值来自json解析）
+func (k OptionKind) match(v interface{}) bool {
+	switch k {
+	case OptionNumber:
+		_, ok := v.(float64)
+		return ok
+	case OptionString:
+		_, ok := v.(string)
+		return ok
+	case OptionBool:
+		_, ok := v.(bool)
+		return ok
+	case OptionStringList:
+		list, ok := v.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return true
+	case OptionStringMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range m {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return true
+	case OptionNumberMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range m {
+			if _, ok := item.(float64); !ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -1,59 +1,36 @@
 package core
 
 import (
-	"errors"
+	"os"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
+//RemoteIsExists 远程文件或目录是否存在
 func RemoteIsExists(pathFile string, client *ssh.Client) (bool, error) {
-	return remoteFileFun(pathFile, "e", client)
+	_, err := NewRemoteFS(client).Stat(pathFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
+//RemoteIsFile 远程路径是否是普通文件
 func RemoteIsFile(pathFile string, client *ssh.Client) (bool, error) {
-	return remoteFileFun(pathFile, "f", client)
-}
-
-func remoteFileFun(pathFile, checkType string, client *ssh.Client) (bool, error) {
-	if pathFile == "" {
-		return false, errors.New("文件名为空")
-	}
-	cmd := NewCmd(client)
-	//判断远程文件是否存在
-	cmd.AddCmd("[ -" + checkType + " " + pathFile + " ] && echo 1 || echo 2")
-	cmd.Run()
-	if cmd.GetRtnCode() != 0 {
-		Log.Error(cmd.ResultMsg())
-		return false, errors.New("远程检查执行错误")
-	}
-	if trim(cmd.GetRtnMsg()) == "2" {
+	fi, err := NewRemoteFS(client).Stat(pathFile)
+	if os.IsNotExist(err) {
 		return false, nil
 	}
-	return true, nil
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode().IsRegular(), nil
 }
 
+//RemoteParsePath 远程路径转换为绝对路径，~开头的相对于$HOME，其他相对于$PWD
 func RemoteParsePath(pathFile string, client *ssh.Client) (string, error) {
-	if pathFile == "" {
-		return "", errors.New("文件名为空")
-	}
-	if pathFile[0] == '/' {
-		return pathFile, nil
-	}
-
-	cmd := NewCmd(client)
-	if pathFile[0] == '.' || pathFile[0] == '~' {
-		cmd.AddCmd("echo $PWD" + pathFile[1:])
-	} else {
-		cmd.AddCmd("echo $PWD/" + pathFile)
-	}
-	cmd.Run()
-	if cmd.GetRtnCode() != 0 {
-		Log.Error(cmd.ResultMsg())
-		return "", errors.New("远程检查执行错误")
-	}
-
-	return trim(cmd.rtnMsg), nil
+	return NewRemoteFS(client).Realpath(pathFile)
 }
 
 func trim(str string) string {
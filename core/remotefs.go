@@ -0,0 +1,329 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 选择stat的参数，GNU使用 -c，BSD使用 -f；输出格式：十六进制mode 大小 修改时间 [文件名]
+const statPrelude = `if stat -c %s / >/dev/null 2>&1; then F=-c; FMT='%f %s %Y'; N='%n'; else F=-f; FMT='%Xp %z %m'; N='%N'; fi; `
+
+//RemoteFS 远程文件系统，每个操作只执行一次shell命令，路径可以是绝对路径、相对于登录目录的路径或~开头的路径
+type RemoteFS struct {
+	client *ssh.Client
+}
+
+//RemoteFileInfo 远程文件信息
+type RemoteFileInfo struct {
+	//Path 绝对路径
+	Path    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+//NewRemoteFS 创建远程文件系统
+func NewRemoteFS(client *ssh.Client) *RemoteFS {
+	return &RemoteFS{client: client}
+}
+
+func (fi *RemoteFileInfo) Name() string       { return path.Base(fi.Path) }
+func (fi *RemoteFileInfo) Size() int64        { return fi.size }
+func (fi *RemoteFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *RemoteFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *RemoteFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *RemoteFileInfo) Sys() interface{}   { return nil }
+
+//Stat 获取文件信息，符号链接返回指向的文件
+func (fs *RemoteFS) Stat(name string) (*RemoteFileInfo, error) {
+	return fs.stat("stat", name)
+}
+
+//Lstat 获取文件信息，符号链接返回链接本身
+func (fs *RemoteFS) Lstat(name string) (*RemoteFileInfo, error) {
+	return fs.stat("lstat", name)
+}
+
+func (fs *RemoteFS) stat(op, name string) (*RemoteFileInfo, error) {
+	infos, err := fs.statAll(op == "stat", name)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if infos[0] == nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return infos[0], nil
+}
+
+//StatAll 一次获取多个文件的信息（符号链接返回指向的文件），不存在的文件对应nil
+func (fs *RemoteFS) StatAll(names ...string) ([]*RemoteFileInfo, error) {
+	return fs.statAll(true, names...)
+}
+
+func (fs *RemoteFS) statAll(follow bool, names ...string) ([]*RemoteFileInfo, error) {
+	words := make([]string, 0, len(names))
+	for _, name := range names {
+		word, err := remotePathWord(name)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	link := ""
+	if follow {
+		link = "-L "
+	}
+	script := statPrelude + "for p in " + strings.Join(words, " ") + `; do printf '%s\n' "$p"; stat ` + link +
+		`$F "$FMT" -- "$p" 2>/dev/null || echo -; done`
+	out, err := fs.run(script)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(out)
+	if len(lines) != 2*len(names) {
+		return nil, errors.New("远程文件信息格式错误：" + out)
+	}
+	infos := make([]*RemoteFileInfo, len(names))
+	for i := range names {
+		if lines[2*i+1] == "-" {
+			continue
+		}
+		fi := &RemoteFileInfo{Path: path.Clean(lines[2*i])}
+		if err := fi.parse(lines[2*i+1]); err != nil {
+			return nil, err
+		}
+		infos[i] = fi
+	}
+	return infos, nil
+}
+
+//ReadDir 列出目录中的文件（不包括.和..），符号链接返回链接本身
+func (fs *RemoteFS) ReadDir(name string) ([]*RemoteFileInfo, error) {
+	word, err := remotePathWord(name)
+	if err != nil {
+		return nil, err
+	}
+	script := statPrelude + "d=" + word + `; if [ ! -e "$d" ]; then echo -; elif [ ! -d "$d" ]; then echo f; ` +
+		`else printf '%s\n' "$d"; cd -- "$d" && stat $F "$FMT $N" -- * .[!.]* ..?* 2>/dev/null; fi; true`
+	out, err := fs.run(script)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(out)
+	if len(lines) == 0 {
+		return nil, errors.New("读取远程目录错误：" + name)
+	}
+	switch lines[0] {
+	case "-":
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+	case "f":
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	dir := path.Clean(lines[0])
+	infos := make([]*RemoteFileInfo, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		fi := &RemoteFileInfo{Path: path.Join(dir, fields[3])}
+		if err := fi.parse(strings.Join(fields[:3], " ")); err != nil {
+			return nil, err
+		}
+		infos = append(infos, fi)
+	}
+	return infos, nil
+}
+
+//Realpath 转换为绝对路径，~开头的相对于$HOME，其他相对于登录目录，不解析符号链接
+func (fs *RemoteFS) Realpath(name string) (string, error) {
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(name), nil
+	}
+	word, err := remotePathWord(name)
+	if err != nil {
+		return "", err
+	}
+	out, err := fs.run(`printf '%s\n' ` + word)
+	if err != nil {
+		return "", err
+	}
+	return path.Clean(strings.TrimRight(out, "\r\n")), nil
+}
+
+//MkdirAll 创建目录及上层目录，perm为最后一级目录的权限
+func (fs *RemoteFS) MkdirAll(name string, perm os.FileMode) error {
+	word, err := remotePathWord(name)
+	if err != nil {
+		return err
+	}
+	mode := strconv.FormatUint(uint64(unixPerm(perm)), 8)
+	_, err = fs.run("mkdir -p -m " + mode + " -- " + word)
+	return err
+}
+
+//Remove 删除文件或空目录
+func (fs *RemoteFS) Remove(name string) error {
+	word, err := remotePathWord(name)
+	if err != nil {
+		return err
+	}
+	out, err := fs.run("p=" + word + `; if [ ! -e "$p" ] && [ ! -L "$p" ]; then echo -; ` +
+		`elif [ -d "$p" ] && [ ! -L "$p" ]; then rmdir -- "$p"; else rm -f -- "$p"; fi`)
+	if err != nil {
+		return err
+	}
+	if trim(out) == "-" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+//RemoveAll 删除文件或目录及其中的所有文件，不存在时不返回错误
+func (fs *RemoteFS) RemoveAll(name string) error {
+	word, err := remotePathWord(name)
+	if err != nil {
+		return err
+	}
+	_, err = fs.run("rm -rf -- " + word)
+	return err
+}
+
+//Rename 重命名或移动文件，目标已存在时覆盖
+func (fs *RemoteFS) Rename(oldname, newname string) error {
+	from, err := remotePathWord(oldname)
+	if err != nil {
+		return err
+	}
+	to, err := remotePathWord(newname)
+	if err != nil {
+		return err
+	}
+	_, err = fs.run("mv -f -- " + from + " " + to)
+	return err
+}
+
+//Chmod 修改文件权限
+func (fs *RemoteFS) Chmod(name string, mode os.FileMode) error {
+	word, err := remotePathWord(name)
+	if err != nil {
+		return err
+	}
+	_, err = fs.run("chmod " + strconv.FormatUint(uint64(unixPerm(mode)), 8) + " -- " + word)
+	return err
+}
+
+// 执行脚本，返回标准输出，有错误输出时返回错误
+func (fs *RemoteFS) run(script string) (string, error) {
+	cmd := NewCmd(fs.client)
+	cmd.AddCmd(script)
+	cmd.Run()
+	if cmd.GetRtnCode() != 0 {
+		Log.Error(cmd.ResultMsg())
+		return "", errors.New("远程命令执行错误：" + trim(cmd.GetRtnMsg()))
+	}
+	return cmd.GetRtnMsg(), nil
+}
+
+// 解析stat输出：十六进制mode 大小 修改时间
+func (fi *RemoteFileInfo) parse(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return errors.New("远程文件信息格式错误：" + line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	mtime, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return err
+	}
+	fi.mode = unixFileMode(uint32(mode))
+	fi.size = size
+	fi.modTime = time.Unix(mtime, 0)
+	return nil
+}
+
+// unix的st_mode转换为os.FileMode
+func unixFileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0010000:
+		mode |= os.ModeNamedPipe
+	case 0140000:
+		mode |= os.ModeSocket
+	case 0020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0060000:
+		mode |= os.ModeDevice
+	}
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// os.FileMode转换为unix的权限位（包括setuid、setgid和sticky）
+func unixPerm(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// 远程路径转换为shell中的绝对路径表达式，~开头的相对于$HOME，其他相对路径相对于$PWD
+func remotePathWord(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("文件名为空")
+	}
+	if name[0] == '/' {
+		return ShellQuote(name), nil
+	}
+	base, rest := "$PWD", "/"+name
+	if name == "~" || strings.HasPrefix(name, "~/") {
+		base, rest = "$HOME", name[1:]
+	}
+	word := `"` + base + `"`
+	if rest != "" {
+		word += ShellQuote(rest)
+	}
+	return word, nil
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return lines
+}
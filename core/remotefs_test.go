@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoteFS(t *testing.T) {
+	ts, server := newTestServer(t)
+	fs := dialTest(t, server).FS()
+
+	name := filepath.Join(ts.Dir, "it's a file")
+	if err := ioutil.WriteFile(name, []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(name, filepath.Join(ts.Dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("~/it's a file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Path != name || fi.Size() != 5 || fi.Mode() != 0640 {
+		t.Fatalf("stat = %s %d %v", fi.Path, fi.Size(), fi.Mode())
+	}
+
+	fi, err = fs.Stat("link")
+	if err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("stat link = %v, %v", fi, err)
+	}
+	fi, err = fs.Lstat("link")
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("lstat link = %v, %v", fi, err)
+	}
+
+	if _, err := fs.Stat("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat missing: err = %v", err)
+	}
+	infos, err := fs.StatAll(ts.Dir, "missing")
+	if err != nil || len(infos) != 2 || !infos[0].IsDir() || infos[1] != nil {
+		t.Fatalf("statAll = %v, %v", infos, err)
+	}
+
+	if err := fs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	list, err := fs.ReadDir("~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, fi := range list {
+		names[fi.Name()] = true
+	}
+	for _, n := range []string{"a", "link", "it's a file", "id_test"} {
+		if !names[n] {
+			t.Errorf("ReadDir missing %q: %v", n, names)
+		}
+	}
+
+	if err := fs.Rename("it's a file", "a/b/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chmod("a/b/moved", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(ts.Dir, "a/b/moved")); err != nil || fi.Mode() != 0600 {
+		t.Fatalf("moved = %v, %v", fi, err)
+	}
+	if err := fs.Remove("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("remove missing: err = %v", err)
+	}
+	if err := fs.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(ts.Dir, "a")); !os.IsNotExist(err) {
+		t.Fatalf("a still exists: %v", err)
+	}
+
+	dir, err := fs.Realpath("~/x/../y")
+	if err != nil || dir != filepath.Join(ts.Dir, "y") {
+		t.Fatalf("realpath = %q, %v", dir, err)
+	}
+}
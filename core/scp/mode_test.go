@@ -0,0 +1,109 @@
+// +build !windows
+
+package scp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkMode(t *testing.T, name string, want os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModePerm != want {
+		t.Errorf("%s: mode = %v, want %v", name, fi.Mode()&os.ModePerm, want)
+	}
+}
+
+func TestChmod(t *testing.T) {
+	s, client := newTestClient(t)
+	local := t.TempDir()
+	writeTree(t, local, map[string]string{"d/f": "file", "d/sub/g": "file"})
+
+	c := NewSCP(client)
+	c.Chmod = func(mode os.FileMode) os.FileMode {
+		if mode.IsDir() {
+			return 0750
+		}
+		return 0600
+	}
+	if err := c.SendDir(filepath.Join(local, "d"), filepath.Join(s.Dir, "d"), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, filepath.Join(s.Dir, "d", "sub"), 0750)
+	checkMode(t, filepath.Join(s.Dir, "d", "f"), 0600)
+	checkMode(t, filepath.Join(s.Dir, "d", "sub", "g"), 0600)
+
+	// directories without write permission are set after their content
+	back := filepath.Join(local, "back")
+	t.Cleanup(func() { os.Chmod(filepath.Join(back, "sub"), 0755) })
+	c.Chmod = func(mode os.FileMode) os.FileMode {
+		if mode.IsDir() {
+			return 0500
+		}
+		return 0444
+	}
+	if err := c.ReceiveDir(filepath.Join(s.Dir, "d"), back, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, filepath.Join(back, "sub"), 0500)
+	checkMode(t, filepath.Join(back, "sub", "g"), 0444)
+	checkMode(t, filepath.Join(back, "f"), 0444)
+}
+
+func TestNoPermissions(t *testing.T) {
+	s, client := newTestClient(t)
+	local := t.TempDir()
+	src := filepath.Join(local, "run.sh")
+	if err := ioutil.WriteFile(src, []byte("#!/bin/sh\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(src, 0777)
+	old := time.Unix(1500000000, 0)
+	if err := os.Chtimes(src, old, old); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(s.Dir, "existing.sh")
+	if err := ioutil.WriteFile(existing, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewSCP(client)
+	c.NoPermissions = true
+	if err := c.SendFile(src, filepath.Join(s.Dir, "new.sh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendFile(src, existing); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range s.Commands() {
+		if strings.Contains(cmd, "-tp") {
+			t.Errorf("command = %q, want scp without -p", cmd)
+		}
+	}
+	checkMode(t, filepath.Join(s.Dir, "new.sh"), 0777&^localUmask)
+	checkMode(t, existing, 0600)
+	if fi, _ := os.Stat(existing); fi.ModTime().Equal(old) {
+		t.Error("mtime was preserved")
+	}
+
+	remote := filepath.Join(s.Dir, "remote.sh")
+	if err := NewSCP(client).SendFile(src, remote); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(local, "back.sh")
+	if err := c.ReceiveFile(remote, dest); err != nil {
+		t.Fatal(err)
+	}
+	checkMode(t, dest, 0777&^localUmask)
+	if fi, _ := os.Stat(dest); fi.ModTime().Equal(old) {
+		t.Error("mtime was preserved")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,6 +28,10 @@ type sourceProtocol struct {
 	remIn     io.WriteCloser
 	remOut    io.Reader
 	remReader *bufio.Reader
+	// 已传输的字节数
+	counter *int64
+	// 远程确认文件头并写入第一批数据后调用，之后中断时远程文件不完整
+	started func()
 }
 
 func newSourceProtocol(remIn io.WriteCloser, remOut io.Reader) (*sourceProtocol, error) {
@@ -83,19 +88,21 @@ func (s *sourceProtocol) writeFile(mode os.FileMode, length int64, filename stri
 	if err != nil {
 		return fmt.Errorf("failed to write scp file header: err=%s", err)
 	}
-	ww := io.Writer(s.remIn)
+	// the remote may refuse the file, e.g. a read-only target, before it is touched
+	err = s.readReply()
+	if err != nil {
+		return err
+	}
+	ww := io.Writer(&bodyWriter{w: s.remIn, started: s.started})
 	pw := NewProxyWriter(ww, filename, int(length))
 	// _, err = io.Copy(s.remIn, body)
-	_, err = io.Copy(pw, body)
+	n, err := io.Copy(pw, body)
+	addCount(s.counter, n)
 	// NOTE: We close body whether or not copy fails and ignore an error from closing body.
 	body.Close()
 	if err != nil {
 		return fmt.Errorf("failed to write scp file body: err=%s", err)
 	}
-	err = s.readReply()
-	if err != nil {
-		return err
-	}
 
 	_, err = s.remIn.Write([]byte{replyOK})
 	if err != nil {
@@ -104,6 +111,21 @@ func (s *sourceProtocol) writeFile(mode os.FileMode, length int64, filename stri
 	return s.readReply()
 }
 
+// bodyWriter calls started once the first bytes of a file body are written.
+type bodyWriter struct {
+	w       io.Writer
+	started func()
+}
+
+func (b *bodyWriter) Write(p []byte) (int, error) {
+	n, err := b.w.Write(p)
+	if n > 0 && b.started != nil {
+		b.started()
+		b.started = nil
+	}
+	return n, err
+}
+
 func (s *sourceProtocol) startDirectory(mode os.FileMode, dirname string) error {
 	// length is not used.
 	length := 0
@@ -147,6 +169,10 @@ type sinkProtocol struct {
 	remIn     io.WriteCloser
 	remOut    io.Reader
 	remReader *bufio.Reader
+	// 已传输的字节数
+	counter *int64
+	// 远程确认文件头并写入第一批数据后调用，之后中断时远程文件不完整
+	started func()
 }
 
 func newSinkProtocol(remIn io.WriteCloser, remOut io.Reader) (*sinkProtocol, error) {
@@ -282,13 +308,8 @@ func (s *sinkProtocol) ReadHeaderOrReply() (interface{}, error) {
 			return nil, fmt.Errorf("failed to read scp reply error message: err=%s", err)
 		}
 
-		if b == replyError {
-			err = s.WriteReplyOK()
-			if err != nil {
-				return nil, fmt.Errorf("failed to write scp replyOK reply: err=%s", err)
-			}
-		}
-
+		// like OpenSSH, errors are not acknowledged, after a non-fatal error
+		// the remote scp continues with the next file
 		return nil, &protocolError{
 			msg:   line,
 			fatal: b == replyFatalError,
@@ -303,6 +324,7 @@ func (s *sinkProtocol) CopyFileBodyTo(h fileMsgHeader, w io.Writer) error {
 	pr := NewProxyReader(lr, h.Name, int(h.Size))
 	// n, err := io.Copy(w, lr)
 	n, err := io.Copy(w, pr)
+	addCount(s.counter, n)
 	if err == io.EOF {
 		if n != h.Size {
 			return fmt.Errorf("unexpected EOF in CopyFileBodyTo: err=%s", err)
@@ -323,3 +345,9 @@ func (s *sinkProtocol) WriteReplyOK() error {
 	_, err := s.remIn.Write([]byte{replyOK})
 	return err
 }
+
+func addCount(counter *int64, n int64) {
+	if counter != nil {
+		atomic.AddInt64(counter, n)
+	}
+}
@@ -8,6 +8,9 @@ import (
 )
 
 var (
+	//ShowProgress 是否在终端显示传输进度，由命令行程序开启
+	ShowProgress = false
+
 	msg = make(chan *View, 10)
 )
 
@@ -69,6 +72,9 @@ func NewProxyReader(r io.Reader, name string, size int) *ProxyReader {
 
 func (proxy *ProxyReader) Read(p []byte) (n int, err error) {
 	n, err = proxy.r.Read(p)
+	if !ShowProgress || proxy.size == 0 {
+		return
+	}
 	if err != nil {
 		msg <- NewView("EOF", proxy.comp/proxy.size)
 		return
@@ -96,6 +102,9 @@ func NewProxyWriter(w io.Writer, name string, size int) *ProxyWriter {
 
 func (proxy *ProxyWriter) Write(p []byte) (n int, err error) {
 	n, err = proxy.w.Write(p)
+	if !ShowProgress || proxy.size == 0 {
+		return
+	}
 	if err != nil {
 		msg <- NewView("EOF", proxy.comp/proxy.size)
 		return
@@ -1,6 +1,18 @@
 package scp
 
-import "golang.org/x/crypto/ssh"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrStalled is returned when no file body bytes are transferred for IdleTimeout.
+var ErrStalled = errors.New("scp: transfer stalled")
 
 // SCP is the type for the SCP client.
 type SCP struct {
@@ -8,6 +20,32 @@ type SCP struct {
 	// Alternate scp command. If not set, scp is used. This can be used
 	// to call scp via sudo by setting it to "sudo scp"
 	SCPCommand string
+	// IdleTimeout aborts the transfer with ErrStalled when no file body
+	// bytes are sent or received for this duration. Zero disables the check.
+	IdleTimeout time.Duration
+	// Symlinks controls how SendDir and ReceiveDir handle symbolic links.
+	// The default is FollowSymlinks, which is what scp -r does.
+	Symlinks SymlinkMode
+	// Warn is called for every entry SendDir and ReceiveDir skip without
+	// failing the transfer: special files, symlink loops, dangling links
+	// and errors reported by the remote scp. If nil, they are skipped silently.
+	Warn func(path string, err error)
+	// NoPermissions copies like scp without -p: times are not preserved,
+	// new files get the sent mode masked by the umask of the receiving side
+	// and existing files keep their mode. By default modes and times are
+	// set to the same value as the source.
+	NoPermissions bool
+	// Chmod rewrites the permission bits of every file and directory that is
+	// sent or received, e.g. to apply chmod rules or a fixed umask. The mode
+	// passed in has os.ModeDir set for directories. If nil, the source
+	// permissions are used.
+	Chmod func(mode os.FileMode) os.FileMode
+
+	ctx         context.Context
+	transferred int64
+	partial     string
+	// the remote file being sent, it becomes partial once its body is written
+	sending string
 }
 
 // NewSCP creates the SCP client.
@@ -18,3 +56,111 @@ func NewSCP(client *ssh.Client) *SCP {
 		client: client,
 	}
 }
+
+// SetContext sets the context of the following transfers. When ctx is done
+// the scp session is closed and the transfer returns ctx.Err().
+func (s *SCP) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// Transferred returns the number of file body bytes sent or received so far.
+func (s *SCP) Transferred() int64 {
+	return atomic.LoadInt64(&s.transferred)
+}
+
+// Partial returns the remote file that was being written when the last
+// upload failed, or "" if there is none. A file is partial only after the
+// remote accepted it and part of its body was written, so files that
+// existed before are not reported when the upload fails before that.
+// Partially received local files are removed by the receive methods themselves.
+func (s *SCP) Partial() string {
+	return s.partial
+}
+
+// RemovePartial removes the remote file returned by Partial.
+func (s *SCP) RemovePartial() error {
+	if s.partial == "" {
+		return nil
+	}
+	session, err := s.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if err := session.Run(s.remoteCommand("rm -f -- " + escapeShellArg(s.partial))); err != nil {
+		return err
+	}
+	s.partial = ""
+	return nil
+}
+
+// perm returns mode with the permission bits rewritten by Chmod.
+func (s *SCP) perm(mode os.FileMode) os.FileMode {
+	if s.Chmod == nil {
+		return mode
+	}
+	return mode&^os.ModePerm | s.Chmod(mode)&os.ModePerm
+}
+
+// sendInfo returns the file information to send for info, with the mode
+// rewritten and without times when permissions are not preserved.
+func (s *SCP) sendInfo(info *FileInfo) *FileInfo {
+	if s.Chmod == nil && !s.NoPermissions {
+		return info
+	}
+	mtime, atime := info.modTime, info.accessTime
+	if s.NoPermissions {
+		mtime, atime = time.Time{}, time.Time{}
+	}
+	return &FileInfo{name: info.name, size: info.size, mode: s.perm(info.mode), modTime: mtime, accessTime: atime}
+}
+
+func (s *SCP) warn(path string, err error) {
+	if s.Warn != nil {
+		s.Warn(path, err)
+	}
+}
+
+// watch closes the session when the context is done or the transfer stalls.
+// The returned function stops watching and returns the reason why the
+// session was closed, or nil.
+func (s *SCP) watch(session io.Closer) func() error {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	done := make(chan struct{})
+	reason := make(chan error, 1)
+	go func() {
+		var tick <-chan time.Time
+		if s.IdleTimeout > 0 {
+			ticker := time.NewTicker(s.IdleTimeout / 4)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		last, lastTime := s.Transferred(), time.Now()
+		for {
+			select {
+			case <-done:
+				reason <- nil
+				return
+			case <-ctx.Done():
+				session.Close()
+				reason <- ctx.Err()
+				return
+			case now := <-tick:
+				if n := s.Transferred(); n != last {
+					last, lastTime = n, now
+				} else if now.Sub(lastTime) >= s.IdleTimeout {
+					session.Close()
+					reason <- ErrStalled
+					return
+				}
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		return <-reason
+	}
+}
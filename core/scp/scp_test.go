@@ -0,0 +1,310 @@
+package scp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gssh/core/sshtest"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestClient(t *testing.T) (*sshtest.Server, *ssh.Client) {
+	t.Helper()
+	s, err := sshtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	client, err := ssh.Dial("tcp", s.Addr, &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{ssh.Password(s.Password)},
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+// writeTree creates files (name -> content) under dir. Names ending in "/" are directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the regular files under dir as relative name -> content.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSendReceiveFile(t *testing.T) {
+	s, client := newTestClient(t)
+	local := t.TempDir()
+	src := filepath.Join(local, "a file.txt")
+	if err := ioutil.WriteFile(src, []byte("hello scp"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := filepath.Join(s.Dir, "it's remote.txt")
+	c := NewSCP(client)
+	if err := c.SendFile(src, remote); err != nil {
+		t.Fatal(err)
+	}
+	if c.Transferred() != 9 {
+		t.Errorf("transferred = %d", c.Transferred())
+	}
+	fi, err := os.Stat(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0640 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("remote mode = %v, mtime = %v", fi.Mode(), fi.ModTime())
+	}
+
+	dest := filepath.Join(local, "back.txt")
+	if err := NewSCP(client).ReceiveFile(remote, dest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(dest)
+	if err != nil || string(data) != "hello scp" {
+		t.Fatalf("received %q, %v", data, err)
+	}
+}
+
+func TestSendReceiveStream(t *testing.T) {
+	s, client := newTestClient(t)
+	remote := filepath.Join(s.Dir, "stream")
+	now := time.Unix(time.Now().Unix(), 0)
+	info := NewFileInfo("stream", 5, 0600, now, now)
+	if err := NewSCP(client).Send(info, ioutil.NopCloser(bytes.NewBufferString("12345")), remote); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	got, err := NewSCP(client).Receive(remote, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "12345" || got.Size() != 5 || got.Mode() != 0600 || !got.ModTime().Equal(now) {
+		t.Fatalf("received %q %d %v %v", buf.String(), got.Size(), got.Mode(), got.ModTime())
+	}
+
+	if _, err := NewSCP(client).Receive(filepath.Join(s.Dir, "missing"), &buf); err == nil {
+		t.Fatal("receiving a missing file succeeded")
+	}
+}
+
+func TestSendReceiveDir(t *testing.T) {
+	s, client := newTestClient(t)
+	files := map[string]string{
+		"top.txt":         "top",
+		"sub/a.txt":       "a",
+		"sub/deep/b.txt":  "b",
+		"skip/c.txt":      "c",
+		"with space/d.md": "d",
+		"empty/":          "",
+	}
+	src := filepath.Join(t.TempDir(), "src")
+	writeTree(t, src, files)
+	delete(files, "empty/")
+
+	// the destination does not exist, so its content is the content of src
+	remote := filepath.Join(s.Dir, "dest")
+	if err := NewSCP(client).SendDir(src, remote, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, remote); !reflect.DeepEqual(got, files) {
+		t.Fatalf("remote tree = %v, want %v", got, files)
+	}
+	if fi, err := os.Stat(filepath.Join(remote, "empty")); err != nil || !fi.IsDir() {
+		t.Fatalf("empty directory: %v, %v", fi, err)
+	}
+
+	skip := func(parentDir string, info os.FileInfo) (bool, error) {
+		return info.Name() != "skip", nil
+	}
+	local := filepath.Join(t.TempDir(), "back")
+	if err := NewSCP(client).ReceiveDir(remote, local, skip); err != nil {
+		t.Fatal(err)
+	}
+	delete(files, "skip/c.txt")
+	if got := readTree(t, local); !reflect.DeepEqual(got, files) {
+		t.Fatalf("local tree = %v, want %v", got, files)
+	}
+}
+
+func TestSendDirPartialPath(t *testing.T) {
+	s, client := newTestClient(t)
+	src := filepath.Join(t.TempDir(), "src")
+	writeTree(t, src, map[string]string{"sub/a.txt": "a"})
+
+	// a missing destination becomes the copy of src, an existing one receives src
+	missing := filepath.ToSlash(filepath.Join(s.Dir, "missing"))
+	existing := filepath.ToSlash(filepath.Join(s.Dir, "existing"))
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for dest, want := range map[string]string{
+		missing:  missing + "/sub/a.txt",
+		existing: existing + "/src/sub/a.txt",
+	} {
+		c := NewSCP(client)
+		if err := c.SendDir(src, dest, nil); err != nil {
+			t.Fatal(err)
+		}
+		if c.sending != want {
+			t.Errorf("SendDir(%q) partial path = %q, want %q", dest, c.sending, want)
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("SendDir(%q): %v", dest, err)
+		}
+
+		// an interrupted transfer removes the file it was writing
+		c.partial = c.sending
+		if err := c.RemovePartial(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(want); !os.IsNotExist(err) {
+			t.Errorf("SendDir(%q): partial file still exists: %v", dest, err)
+		}
+	}
+}
+
+func TestRemovePartial(t *testing.T) {
+	s, client := newTestClient(t)
+	c := NewSCP(client)
+	c.partial = filepath.Join(s.Dir, "it's partial")
+	if err := ioutil.WriteFile(c.partial, []byte("half"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemovePartial(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, "it's partial")); !os.IsNotExist(err) {
+		t.Fatalf("partial file still exists: %v", err)
+	}
+	if c.Partial() != "" {
+		t.Fatalf("Partial() = %q", c.Partial())
+	}
+}
+
+func TestSendCanceledKeepsFile(t *testing.T) {
+	s, client := newTestClient(t)
+	src := filepath.Join(t.TempDir(), "new")
+	if err := ioutil.WriteFile(src, []byte("new content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(s.Dir, "existing")
+	if err := ioutil.WriteFile(remote, []byte("old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := NewSCP(client)
+	c.SetContext(ctx)
+	if err := c.SendFile(src, remote); err == nil {
+		t.Fatal("SendFile succeeded with a canceled context")
+	}
+	if c.Partial() != "" {
+		t.Errorf("Partial() = %q before the body was written", c.Partial())
+	}
+	if err := c.RemovePartial(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(remote); err != nil || string(data) != "old content" {
+		t.Fatalf("existing file = %q, %v", data, err)
+	}
+}
+
+// failingReader returns data and then an error.
+type failingReader struct{ data []byte }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("read failed")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestSendPartial(t *testing.T) {
+	s, client := newTestClient(t)
+	c := NewSCP(client)
+	info := NewFileInfo("half", 100, 0644, time.Time{}, time.Time{})
+	if err := c.Send(info, ioutil.NopCloser(&failingReader{data: []byte("half")}), filepath.Join(s.Dir, "half")); err == nil {
+		t.Fatal("Send succeeded with a failing reader")
+	}
+	if want := filepath.ToSlash(filepath.Join(s.Dir, "half")); c.Partial() != want {
+		t.Fatalf("Partial() = %q, want %q", c.Partial(), want)
+	}
+}
+
+func TestReceiveSparseFile(t *testing.T) {
+	s, client := newTestClient(t)
+	// data, a hole in the middle and zeros at the end
+	data := make([]byte, 5*sparseBlock+100)
+	copy(data, "head")
+	copy(data[3*sparseBlock:], "middle")
+	remote := filepath.Join(s.Dir, "sparse")
+	if err := ioutil.WriteFile(remote, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(t.TempDir(), "sparse")
+	if err := NewSCP(client).ReceiveFile(remote, local); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("received %d bytes, want %d, content differs", len(got), len(data))
+	}
+}
@@ -1,12 +1,16 @@
 package scp
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -17,7 +21,7 @@ import (
 func (s *SCP) Receive(srcFile string, dest io.Writer) (*FileInfo, error) {
 	var info *FileInfo
 	srcFile = realPath(filepath.Clean(srcFile))
-	err := runSinkSession(s.client, srcFile, false, s.SCPCommand, false, true, func(s *sinkSession) error {
+	err := runSinkSession(s, srcFile, false, s.SCPCommand, false, !s.NoPermissions, func(s *sinkSession) error {
 		var timeHeader timeMsgHeader
 		// loop over headers until we get the file content
 		for {
@@ -52,7 +56,7 @@ func (s *SCP) Receive(srcFile string, dest io.Writer) (*FileInfo, error) {
 
 // ReceiveFile copies a single remote file to the local machine with
 // the specified name. The time and permission will be set to the same value
-// of the source file.
+// of the source file, see NoPermissions and Chmod.
 func (s *SCP) ReceiveFile(srcFile, destFile string) error {
 	srcFile = realPath(filepath.Clean(srcFile))
 	destFile = filepath.Clean(destFile)
@@ -64,63 +68,94 @@ func (s *SCP) ReceiveFile(srcFile, destFile string) error {
 		destFile = filepath.Join(destFile, filepath.Base(srcFile))
 	}
 
+	_, err = os.Stat(destFile)
+	created := os.IsNotExist(err)
 	file, err := os.OpenFile(destFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("failed to open destination file: err=%s", err)
 	}
 	defer file.Close()
 
-	fi, err := s.Receive(srcFile, file)
+	w := newSparseWriter(file)
+	fi, err := s.Receive(srcFile, w)
+	if err == nil {
+		err = w.Finish()
+	}
 	if err != nil {
+		// remove the incomplete file
 		file.Close()
+		os.Remove(destFile)
 		return err
 	}
 
 	// adapt permissions and header based on the information from fi
-	err = os.Chmod(destFile, fi.Mode())
+	mode := s.perm(fi.Mode())
+	switch {
+	case !s.NoPermissions:
+		err = os.Chmod(destFile, mode)
+	case created:
+		// the mode is not known when the file is created
+		err = os.Chmod(destFile, mode&^localUmask)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to change file mode: err=%s", err)
 	}
 
-	err = os.Chtimes(destFile, fi.AccessTime(), fi.ModTime())
+	return setTimes(destFile, fi.AccessTime(), fi.ModTime())
+}
+
+// setTimes sets the times received with the file, they are zero when
+// permissions are not preserved.
+func setTimes(name string, atime, mtime time.Time) error {
+	if mtime.IsZero() {
+		return nil
+	}
+	err := os.Chtimes(name, atime, mtime)
 	if err != nil {
 		return fmt.Errorf("failed to change file time: err=%s", err)
 	}
-
 	return nil
 }
 
-func copyFileBodyFromRemote(s *sinkSession, localFilename string, timeHeader timeMsgHeader, fileHeader fileMsgHeader) error {
-	file, err := os.OpenFile(localFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileHeader.Mode)
+func (c *SCP) copyFileBodyFromRemote(s *sinkSession, localFilename string, timeHeader timeMsgHeader, fileHeader fileMsgHeader) error {
+	mode := c.perm(fileHeader.Mode)
+	// new files get the mode masked by the umask
+	file, err := os.OpenFile(localFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return fmt.Errorf("failed to open destination file: err=%s", err)
 	}
 
-	err = s.CopyFileBodyTo(fileHeader, file)
+	w := newSparseWriter(file)
+	err = s.CopyFileBodyTo(fileHeader, w)
+	if err == nil {
+		err = w.Finish()
+	}
 	if err != nil {
+		// remove the incomplete file
 		file.Close()
+		os.Remove(localFilename)
 		return fmt.Errorf("failed to copy file: err=%s", err)
 	}
 	file.Close()
 
-	err = os.Chmod(localFilename, fileHeader.Mode)
-	if err != nil {
-		return fmt.Errorf("failed to change file mode: err=%s", err)
-	}
-
-	err = os.Chtimes(localFilename, timeHeader.Atime, timeHeader.Mtime)
-	if err != nil {
-		return fmt.Errorf("failed to change file time: err=%s", err)
+	if !c.NoPermissions {
+		err = os.Chmod(localFilename, mode)
+		if err != nil {
+			return fmt.Errorf("failed to change file mode: err=%s", err)
+		}
 	}
 
-	return nil
+	return setTimes(localFilename, timeHeader.Atime, timeHeader.Mtime)
 }
 
 // ReceiveDir copies files and directories under a remote srcDir to
 // to the destDir on the local machine. You can filter the files and directories
 // to be copied with acceptFn. If acceptFn is nil, all files and directories will
 // be copied. The time and permission will be set to the same value of the source
-// file or directory.
+// file or directory, see NoPermissions and Chmod.
+// Symbolic links are handled as set by Symlinks. The remote scp follows all
+// links, so skipped links to files are still transferred and discarded.
+// Special files and other errors reported by the remote scp are passed to Warn.
 func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 	srcDir = realPath(filepath.Clean(srcDir))
 	destDir = filepath.Clean(destDir)
@@ -141,17 +176,71 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 		acceptFn = acceptAny
 	}
 
-	return runSinkSession(s.client, srcDir, false, s.SCPCommand, true, true, func(s *sinkSession) error {
+	links, err := s.scanRemoteLinks(srcDir, s.Symlinks == FollowSymlinks)
+	if err != nil {
+		return fmt.Errorf("failed to list symlinks: err=%s", err)
+	}
+	// the local directory with the content of srcDir, set by the first directory message
+	var topDir string
+	// skipLink reports whether the local file or directory name is a link
+	// that is not copied
+	skipLink := func(name string) bool {
+		if topDir == "" {
+			return false
+		}
+		rel, err := filepath.Rel(topDir, name)
+		if err != nil {
+			return false
+		}
+		l, ok := links[filepath.ToSlash(rel)]
+		if !ok {
+			return false
+		}
+		if s.Symlinks == FollowSymlinks {
+			if l.loop {
+				s.warn(path.Join(srcDir, filepath.ToSlash(rel)), ErrSymlinkLoop)
+			}
+			return l.loop
+		}
+		return true
+	}
+	// expected reports whether a remote error is about a link that is not
+	// copied anyway, like a dangling link, or a file under such a link
+	expected := func(msg string) bool {
+		for p, l := range links {
+			if s.Symlinks == FollowSymlinks && !l.loop {
+				continue
+			}
+			if strings.Contains(msg, "/"+p+":") || strings.Contains(msg, "/"+p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := s
+	err = runSinkSession(s, srcDir, false, s.SCPCommand, true, !s.NoPermissions, func(s *sinkSession) error {
 		curDir := destDir
 		var timeHeader timeMsgHeader
 		var timeHeaders []timeMsgHeader
+		// modes of the directories, set when they are complete
+		var dirModes []os.FileMode
 		isFirstStartDirectory := true
 		var skipBaseDir string
 		for {
 			h, err := s.ReadHeaderOrReply()
 			if err == io.EOF {
 				break
-			} else if err != nil {
+			}
+			if pe, ok := err.(*protocolError); ok && !pe.Fatal() {
+				// the remote scp skips the file and continues
+				s.warnings++
+				if !expected(pe.msg) {
+					c.warn(srcDir, errors.New(strings.TrimSpace(pe.msg)))
+				}
+				continue
+			}
+			if err != nil {
 				return fmt.Errorf("failed to read scp message header: err=%s", err)
 			}
 			switch h.(type) {
@@ -163,16 +252,23 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 				if isFirstStartDirectory {
 					isFirstStartDirectory = false
 					if skipsFirstDirectory {
+						topDir = curDir
 						continue
 					}
+					topDir = filepath.Join(curDir, dirHeader.Name)
 				}
 
 				curDir = filepath.Join(curDir, dirHeader.Name)
 				timeHeaders = append(timeHeaders, timeHeader)
+				dirModes = append(dirModes, 0)
 
 				if skipBaseDir != "" {
 					continue
 				}
+				if skipLink(curDir) {
+					skipBaseDir = curDir
+					continue
+				}
 
 				info := NewFileInfo(dirHeader.Name, 0, dirHeader.Mode|os.ModeDir, timeHeader.Mtime, timeHeader.Atime)
 				accepted, err := acceptFn(filepath.Dir(curDir), info)
@@ -184,23 +280,37 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 					continue
 				}
 
-				err = os.MkdirAll(curDir, dirHeader.Mode)
+				// the owner needs to write the content before the mode is set
+				mode := c.perm(dirHeader.Mode | os.ModeDir)
+				err = os.MkdirAll(curDir, mode|0700)
 				if err != nil {
 					return fmt.Errorf("failed to create directory: err=%s", err)
 				}
-
-				err = os.Chmod(curDir, dirHeader.Mode)
-				if err != nil {
-					return fmt.Errorf("failed to change directory mode: err=%s", err)
+				if !c.NoPermissions {
+					err = os.Chmod(curDir, mode|0700)
+					if err != nil {
+						return fmt.Errorf("failed to change directory mode: err=%s", err)
+					}
+					dirModes[len(dirModes)-1] = mode
 				}
 			case endDirectoryMsgHeader:
 				if len(timeHeaders) > 0 {
 					timeHeader = timeHeaders[len(timeHeaders)-1]
 					timeHeaders = timeHeaders[:len(timeHeaders)-1]
+					mode := dirModes[len(dirModes)-1]
+					dirModes = dirModes[:len(dirModes)-1]
 					if skipBaseDir == "" {
-						err := os.Chtimes(curDir, timeHeader.Atime, timeHeader.Mtime)
-						if err != nil {
-							return fmt.Errorf("failed to change directory time: err=%s", err)
+						if mode != 0 && mode&0700 != 0700 {
+							err := os.Chmod(curDir, mode)
+							if err != nil {
+								return fmt.Errorf("failed to change directory mode: err=%s", err)
+							}
+						}
+						if !timeHeader.Mtime.IsZero() {
+							err := os.Chtimes(curDir, timeHeader.Atime, timeHeader.Mtime)
+							if err != nil {
+								return fmt.Errorf("failed to change directory time: err=%s", err)
+							}
 						}
 					}
 				}
@@ -222,7 +332,7 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 				}
 			case fileMsgHeader:
 				fileHeader := h.(fileMsgHeader)
-				if skipBaseDir == "" {
+				if skipBaseDir == "" && !skipLink(filepath.Join(curDir, fileHeader.Name)) {
 					info := NewFileInfo(fileHeader.Name, fileHeader.Size, fileHeader.Mode, timeHeader.Mtime, timeHeader.Atime)
 					accepted, err := acceptFn(curDir, info)
 					if err != nil {
@@ -232,7 +342,7 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 						continue
 					}
 					localFilename := filepath.Join(curDir, fileHeader.Name)
-					err = copyFileBodyFromRemote(s, localFilename, timeHeader, fileHeader)
+					err = c.copyFileBodyFromRemote(s, localFilename, timeHeader, fileHeader)
 					if err != nil {
 						return err
 					}
@@ -248,6 +358,16 @@ func (s *SCP) ReceiveDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 		}
 		return nil
 	})
+	if err != nil || s.Symlinks != PreserveSymlinks || topDir == "" {
+		return err
+	}
+
+	preserved := make([]symlink, 0, len(links))
+	for p, l := range links {
+		preserved = append(preserved, symlink{path: p, target: l.target})
+	}
+	sort.Slice(preserved, func(i, j int) bool { return preserved[i].path < preserved[j].path })
+	return createLocalLinks(topDir, preserved, acceptFn)
 }
 
 func isSubdirectory(basepath, targetpath string) (bool, error) {
@@ -255,7 +375,7 @@ func isSubdirectory(basepath, targetpath string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return !strings.HasPrefix(rel, ".."+string([]rune{filepath.Separator})), nil
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string([]rune{filepath.Separator})), nil
 }
 
 type sinkSession struct {
@@ -268,6 +388,8 @@ type sinkSession struct {
 	updatesPermission bool
 	stdin             io.WriteCloser
 	stdout            io.Reader
+	// non-fatal errors reported by the remote scp
+	warnings int
 	*sinkProtocol
 }
 
@@ -336,17 +458,28 @@ func (s *sinkSession) Wait() error {
 	return s.session.Wait()
 }
 
-func runSinkSession(client *ssh.Client, remoteSrcPath string, remoteSrcIsDir bool, scpPath string, recursive, updatesPermission bool, handler func(s *sinkSession) error) error {
-	s, err := newSinkSession(client, remoteSrcPath, remoteSrcIsDir, scpPath, recursive, updatesPermission)
+func runSinkSession(c *SCP, remoteSrcPath string, remoteSrcIsDir bool, scpPath string, recursive, updatesPermission bool, handler func(s *sinkSession) error) error {
+	if c.ctx != nil && c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	s, err := newSinkSession(c.client, remoteSrcPath, remoteSrcIsDir, scpPath, recursive, updatesPermission)
 	defer s.Close()
 	if err != nil {
 		return err
 	}
+	s.sinkProtocol.counter = &c.transferred
+	stop := c.watch(s)
 
 	err = handler(s)
-	if err != nil {
-		return err
+	if err == nil {
+		err = s.Wait()
+		// the remote scp exits with 1 after skipping files, which were reported already
+		if _, ok := err.(*ssh.ExitError); ok && s.warnings > 0 {
+			err = nil
+		}
 	}
-
-	return s.Wait()
+	if reason := stop(); reason != nil && err != nil {
+		return reason
+	}
+	return err
 }
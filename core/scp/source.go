@@ -3,23 +3,27 @@ package scp
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
 // Send reads a single local file content from the r,
 // and copies it to the remote file with the name destFile.
-// The time and permission will be set with the value of info.
+// The time and permission will be set with the value of info, see
+// NoPermissions and Chmod.
 // The r will be closed after copying. If you don't want for r to be
 // closed, you can pass the result of ioutil.NopCloser(r).
 func (s *SCP) Send(info *FileInfo, r io.ReadCloser, destFile string) error {
 	destFile = filepath.Clean(destFile)
 	destFile = realPath(filepath.Dir(destFile))
 
-	return runSourceSession(s.client, destFile, false, s.SCPCommand, false, true, func(s *sourceSession) error {
+	s.partial, s.sending = "", filepath.ToSlash(filepath.Join(destFile, filepath.Base(info.Name())))
+	info = s.sendInfo(info)
+	return runSourceSession(s, destFile, false, s.SCPCommand, false, !s.NoPermissions, func(s *sourceSession) error {
 		err := s.WriteFile(info, r)
 		if err != nil {
 			return fmt.Errorf("failed to copy file: err=%s", err)
@@ -29,17 +33,20 @@ func (s *SCP) Send(info *FileInfo, r io.ReadCloser, destFile string) error {
 }
 
 // SendFile copies a single local file to the remote server.
-// The time and permission will be set with the value of the source file.
+// The time and permission will be set with the value of the source file,
+// see NoPermissions and Chmod.
 func (s *SCP) SendFile(srcFile, destFile string) error {
 	srcFile = filepath.Clean(srcFile)
 	destFile = realPath(filepath.Clean(destFile))
 
-	return runSourceSession(s.client, destFile, false, s.SCPCommand, false, true, func(s *sourceSession) error {
+	s.partial, s.sending = "", destFile
+	c := s
+	return runSourceSession(s, destFile, false, s.SCPCommand, false, !s.NoPermissions, func(s *sourceSession) error {
 		osFileInfo, err := os.Stat(srcFile)
 		if err != nil {
 			return fmt.Errorf("failed to stat source file: err=%s", err)
 		}
-		fi := newFileInfoFromOS(osFileInfo, "")
+		fi := c.sendInfo(newFileInfoFromOS(osFileInfo, ""))
 
 		file, err := os.Open(srcFile)
 		if err != nil {
@@ -70,99 +77,143 @@ func acceptAny(parentDir string, info os.FileInfo) (bool, error) {
 // over the network even if some files are filtered out. If you need more efficiency,
 // it is better to use another method like the tar command.
 // If acceptFn is nil, all files and directories will be copied.
-// The time and permission will be set to the same value of the source file or directory.
+// The time and permission will be set to the same value of the source file or directory,
+// see NoPermissions and Chmod.
+// Symbolic links are handled as set by Symlinks, special files are skipped with a warning.
 func (s *SCP) SendDir(srcDir, destDir string, acceptFn AcceptFunc) error {
 	srcDir = filepath.Clean(srcDir)
 	destDir = realPath(filepath.Clean(destDir))
+	s.partial = ""
 	if acceptFn == nil {
 		acceptFn = acceptAny
 	}
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to stat source directory: err=%s", err)
+	}
 
-	return runSourceSession(s.client, destDir, false, s.SCPCommand, true, true, func(s *sourceSession) error {
-		prevDirSkipped := false
-
-		endDirectories := func(prevDir, dir string) error {
-			rel, err := filepath.Rel(prevDir, dir)
-			if err != nil {
-				return err
-			}
-			for _, comp := range strings.Split(rel, string([]rune{filepath.Separator})) {
-				if comp == ".." {
-					if prevDirSkipped {
-						prevDirSkipped = false
-					} else {
-						err := s.EndDirectory()
-						if err != nil {
-							return err
-						}
-					}
-				}
-			}
-			return nil
-		}
+	// the content of srcDir goes to destDir/base(srcDir) if destDir already
+	// exists, otherwise scp creates destDir itself; links and partial files
+	// are relative to that directory
+	root := destDir
+	isDir, err := s.isRemoteDir(destDir)
+	if err != nil {
+		return err
+	}
+	if isDir {
+		root = path.Join(destDir, filepath.Base(srcDir))
+	}
 
-		prevDir := srcDir
-		myWalkFn := func(path string, info os.FileInfo, err error) error {
-			// We must check err is not nil first.
-			// See https://golang.org/pkg/path/filepath/#WalkFunc
-			if err != nil {
-				return err
-			}
+	w := &dirSender{scp: s, srcDir: srcDir, root: root, acceptFn: acceptFn}
+	err = runSourceSession(s, destDir, false, s.SCPCommand, true, !s.NoPermissions, func(session *sourceSession) error {
+		w.session = session
+		return w.send(srcDir, info, nil)
+	})
+	if err != nil || len(w.links) == 0 {
+		return err
+	}
+	return s.createRemoteLinks(root, w.links)
+}
 
-			isDir := info.IsDir()
-			var dir string
-			if isDir {
-				dir = path
-			} else {
-				dir = filepath.Dir(path)
-			}
-			defer func() {
-				prevDir = dir
-			}()
+// dirSender walks the local directory of SendDir.
+type dirSender struct {
+	scp     *SCP
+	session *sourceSession
+	srcDir  string
+	// remote directory that receives the content of srcDir
+	root     string
+	acceptFn AcceptFunc
+	// links to create after the transfer when preserving symlinks
+	links []symlink
+}
 
-			err = endDirectories(prevDir, dir)
-			if err != nil {
-				return err
+// send copies the file or directory p, parents are the directories above it,
+// used to detect links to one of them.
+func (w *dirSender) send(p string, info os.FileInfo, parents []os.FileInfo) error {
+	name := info.Name()
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch w.scp.Symlinks {
+		case SkipSymlinks:
+			return nil
+		case PreserveSymlinks:
+			return w.addLink(p, info)
+		}
+		target, err := os.Stat(p)
+		if err != nil {
+			w.scp.warn(p, err)
+			return nil
+		}
+		info = target
+	}
+	fi := newFileInfoFromOS(info, name)
+
+	switch {
+	case info.IsDir():
+		for _, parent := range parents {
+			if os.SameFile(parent, info) {
+				w.scp.warn(p, ErrSymlinkLoop)
+				return nil
 			}
-
-			scpFileInfo := newFileInfoFromOS(info, "")
-			accepted, err := acceptFn(filepath.Dir(path), scpFileInfo)
-			if err != nil {
+		}
+		accepted, err := w.acceptFn(filepath.Dir(p), fi)
+		if err != nil || !accepted {
+			return err
+		}
+		list, err := ioutil.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		if err := w.session.StartDirectory(w.scp.sendInfo(fi)); err != nil {
+			return err
+		}
+		parents = append(parents, info)
+		for _, child := range list {
+			if err := w.send(filepath.Join(p, child.Name()), child, parents); err != nil {
 				return err
 			}
-
-			if isDir {
-				if !accepted {
-					prevDirSkipped = true
-					return filepath.SkipDir
-				}
-
-				err := s.StartDirectory(scpFileInfo)
-				if err != nil {
-					return err
-				}
-			} else {
-				if accepted {
-					fi := newFileInfoFromOS(info, "")
-					file, err := os.Open(path)
-					if err != nil {
-						return err
-					}
-					err = s.WriteFile(fi, file)
-					if err != nil {
-						return err
-					}
-				}
-			}
-			return nil
 		}
-		err := filepath.Walk(srcDir, myWalkFn)
+		return w.session.EndDirectory()
+	case info.Mode().IsRegular():
+		accepted, err := w.acceptFn(filepath.Dir(p), fi)
+		if err != nil || !accepted {
+			return err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(w.srcDir, p)
 		if err != nil {
 			return err
 		}
+		w.scp.sending = path.Join(w.root, filepath.ToSlash(rel))
+		if err := w.session.WriteFile(w.scp.sendInfo(fi), file); err != nil {
+			return err
+		}
+		w.scp.partial = ""
+		return nil
+	default:
+		w.scp.warn(p, ErrSpecialFile)
+		return nil
+	}
+}
 
-		return endDirectories(prevDir, srcDir)
-	})
+// addLink records the link p to create on the remote side.
+func (w *dirSender) addLink(p string, info os.FileInfo) error {
+	accepted, err := w.acceptFn(filepath.Dir(p), newFileInfoFromOS(info, ""))
+	if err != nil || !accepted {
+		return err
+	}
+	target, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(w.srcDir, p)
+	if err != nil {
+		return err
+	}
+	w.links = append(w.links, symlink{path: filepath.ToSlash(rel), target: target})
+	return nil
 }
 
 type sourceSession struct {
@@ -250,19 +301,31 @@ func (s *sourceSession) CloseStdin() error {
 	return s.stdin.Close()
 }
 
-func runSourceSession(client *ssh.Client, remoteDestPath string, remoteDestIsDir bool, scpPath string, recursive, updatesPermission bool, handler func(s *sourceSession) error) error {
-	s, err := newSourceSession(client, remoteDestPath, remoteDestIsDir, scpPath, recursive, updatesPermission)
+func runSourceSession(c *SCP, remoteDestPath string, remoteDestIsDir bool, scpPath string, recursive, updatesPermission bool, handler func(s *sourceSession) error) error {
+	if c.ctx != nil && c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	s, err := newSourceSession(c.client, remoteDestPath, remoteDestIsDir, scpPath, recursive, updatesPermission)
 	defer s.Close()
 	if err != nil {
 		return err
 	}
+	s.sourceProtocol.counter = &c.transferred
+	s.sourceProtocol.started = func() { c.partial = c.sending }
+	stop := c.watch(s)
 	err = func() error {
 		defer s.CloseStdin()
 
 		return handler(s)
 	}()
-	if err != nil {
-		return err
+	if err == nil {
+		err = s.Wait()
+	}
+	if reason := stop(); reason != nil && err != nil {
+		return reason
+	}
+	if err == nil {
+		c.partial = ""
 	}
-	return s.Wait()
+	return err
 }
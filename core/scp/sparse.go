@@ -0,0 +1,70 @@
+package scp
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlock is the size of the zero blocks that are skipped instead of written.
+const sparseBlock = 4096
+
+// sparseWriter writes a received file body, seeking over blocks of zeros so
+// that the file system can keep them as holes. The scp protocol always sends
+// the full content, so holes of sparse files are restored only when receiving.
+type sparseWriter struct {
+	f *os.File
+	// zeros skipped at the end of the file
+	pending int64
+}
+
+func newSparseWriter(f *os.File) *sparseWriter {
+	return &sparseWriter{f: f}
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > sparseBlock {
+			chunk = chunk[:sparseBlock]
+		}
+		if isZero(chunk) {
+			w.pending += int64(len(chunk))
+		} else {
+			if w.pending > 0 {
+				if _, err := w.f.Seek(w.pending, io.SeekCurrent); err != nil {
+					return n, err
+				}
+				w.pending = 0
+			}
+			if _, err := w.f.Write(chunk); err != nil {
+				return n, err
+			}
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Finish extends the file over the zeros skipped at the end.
+func (w *sparseWriter) Finish() error {
+	if w.pending == 0 {
+		return nil
+	}
+	offset, err := w.f.Seek(w.pending, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	w.pending = 0
+	return w.f.Truncate(offset)
+}
+
+func isZero(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package scp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SymlinkMode tells SendDir and ReceiveDir what to do with symbolic links
+// under the copied directory. The scp protocol cannot carry links, so
+// PreserveSymlinks and the loop detection of FollowSymlinks in ReceiveDir
+// run one extra remote command (find, readlink, ln) next to the transfer.
+type SymlinkMode int
+
+const (
+	// FollowSymlinks copies the files and directories the links point to,
+	// like scp -r. Links to a directory that contains them are skipped with
+	// ErrSymlinkLoop and dangling links are skipped with a warning.
+	FollowSymlinks SymlinkMode = iota
+	// SkipSymlinks does not copy symbolic links at all.
+	SkipSymlinks
+	// PreserveSymlinks recreates the links with the same target on the other
+	// side after the files are copied. The targets are not copied.
+	PreserveSymlinks
+)
+
+var (
+	// ErrSpecialFile is passed to Warn for devices, FIFOs and sockets,
+	// which scp cannot copy.
+	ErrSpecialFile = errors.New("scp: not a regular file or directory")
+	// ErrSymlinkLoop is passed to Warn for links to a directory that
+	// contains them, which would be copied endlessly when followed.
+	ErrSymlinkLoop = errors.New("scp: symlink loop")
+)
+
+// maxLinkRounds limits how many levels of linked directories ReceiveDir
+// scans for loops.
+const maxLinkRounds = 32
+
+// symlink is a link to recreate, path is relative to the copied directory
+// and uses "/" as the separator.
+type symlink struct {
+	path   string
+	target string
+}
+
+// remoteLink is a symbolic link found under the source directory of ReceiveDir.
+type remoteLink struct {
+	target string
+	// physical path of the target if it is a directory
+	dir  string
+	loop bool
+}
+
+// remoteCommand runs script with the same prefix as SCPCommand, so that
+// "sudo scp" runs it with sudo too.
+func (s *SCP) remoteCommand(script string) string {
+	words := strings.Fields(s.SCPCommand)
+	if len(words) < 2 {
+		return "sh -c " + escapeShellArg(script)
+	}
+	return strings.Join(words[:len(words)-1], " ") + " sh -c " + escapeShellArg(script)
+}
+
+// runScript runs script on the remote host and returns its standard output
+// and error output.
+func (s *SCP) runScript(script string) ([]byte, string, error) {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return nil, "", err
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	out, err := session.Output(s.remoteCommand(script))
+	return out, strings.TrimSpace(stderr.String()), err
+}
+
+// isRemoteDir reports whether name is an existing remote directory.
+func (s *SCP) isRemoteDir(name string) (bool, error) {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+	err = session.Run(s.remoteCommand("test -d " + escapeShellArg(name)))
+	if _, ok := err.(*ssh.ExitError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// createRemoteLinks creates links under the remote directory root,
+// replacing files that are in the way.
+func (s *SCP) createRemoteLinks(root string, links []symlink) error {
+	script := "cd -- " + escapeShellArg(root)
+	for _, l := range links {
+		script += " && ln -sfn -- " + escapeShellArg(l.target) + " " + escapeShellArg("./"+l.path)
+	}
+	if _, stderr, err := s.runScript(script); err != nil {
+		if stderr != "" {
+			err = errors.New(stderr)
+		}
+		return fmt.Errorf("failed to create symlinks: err=%s", err)
+	}
+	return nil
+}
+
+// createLocalLinks creates links under the local directory root. Links whose
+// parent directory was not copied are skipped.
+func createLocalLinks(root string, links []symlink, acceptFn AcceptFunc) error {
+	for _, l := range links {
+		name := filepath.Join(root, filepath.FromSlash(l.path))
+		dir := filepath.Dir(name)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+		info := NewFileInfo(filepath.Base(name), int64(len(l.target)), os.ModeSymlink|0777, time.Time{}, time.Time{})
+		accepted, err := acceptFn(dir, info)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			continue
+		}
+		if fi, err := os.Lstat(name); err == nil && !fi.IsDir() {
+			os.Remove(name)
+		}
+		if err := os.Symlink(l.target, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The script prints the physical path of the source directory, then the path,
+// readlink output and the physical path of directory targets of every link
+// under the given directories, all separated by NUL. find does not descend
+// into linked directories, they are passed in the next round when following.
+const scanLinksScript = `cd -P -- %s && printf '%%s\0' "$(pwd -P)" && for d in %s; do find -H "$d" -type l -exec sh -c 'for l in "$@"; do t=$(readlink "$l"); r=; if [ -d "$l" ]; then r=$(cd -P -- "$l" && pwd -P); fi; printf "%%s\0%%s\0%%s\0" "$l" "$t" "$r"; done' sh {} +; done`
+
+// scanRemoteLinks lists the symbolic links under the remote srcDir, keyed by
+// the path relative to srcDir. When following links, the linked directories
+// are scanned too and links to a directory above them are marked as loops.
+func (s *SCP) scanRemoteLinks(srcDir string, follow bool) (map[string]*remoteLink, error) {
+	links := make(map[string]*remoteLink)
+	// physical paths of the scanned directories
+	phys := make(map[string]string)
+	physOf := func(p string) string {
+		for q := p; ; q = path.Dir(q) {
+			if dir, ok := phys[q]; ok {
+				return path.Join(dir, strings.TrimPrefix(p, q))
+			}
+			if q == "." {
+				return ""
+			}
+		}
+	}
+
+	dirs := []string{"."}
+	for round := 0; len(dirs) > 0 && round < maxLinkRounds; round++ {
+		words := make([]string, 0, len(dirs))
+		for _, d := range dirs {
+			words = append(words, escapeShellArg("./"+d))
+		}
+		out, _, err := s.runScript(fmt.Sprintf(scanLinksScript, escapeShellArg(srcDir), strings.Join(words, " ")))
+		fields := strings.Split(string(out), "\x00")
+		if len(fields) < 2 {
+			// the source is missing or not a directory, scp reports it
+			if _, ok := err.(*ssh.ExitError); ok || err == nil {
+				return links, nil
+			}
+			return nil, err
+		}
+		phys["."] = fields[0]
+
+		dirs = nil
+		for i := 1; i+2 < len(fields); i += 3 {
+			p := path.Clean(fields[i])
+			l := &remoteLink{target: fields[i+1], dir: fields[i+2]}
+			links[p] = l
+			if l.dir == "" || !follow {
+				continue
+			}
+			for q := path.Dir(p); ; q = path.Dir(q) {
+				if within(physOf(q), l.dir) {
+					l.loop = true
+					break
+				}
+				if q == "." {
+					break
+				}
+			}
+			if !l.loop {
+				phys[p] = l.dir
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	return links, nil
+}
+
+// within reports whether the slash separated path p is dir or under dir.
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,168 @@
+// +build !windows
+
+package scp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+// makeLinkTree creates a directory "src" under dir with a file, a FIFO and
+// links to a file, to a directory outside, to its parent (a loop) and to nothing.
+func makeLinkTree(t *testing.T, dir string) string {
+	t.Helper()
+	src := filepath.Join(dir, "src")
+	writeTree(t, dir, map[string]string{
+		"src/a/file.txt": "file",
+		"ext/e.txt":      "ext",
+	})
+	links := map[string]string{
+		"src/a/link.txt": "file.txt",
+		"src/ext":        "../ext",
+		"src/a/up":       "..",
+		"src/dangling":   "nowhere",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+// readLinks returns the links under dir as relative name -> target.
+func readLinks(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	links := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		links[filepath.ToSlash(rel)] = target
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+type warnings []string
+
+func (w *warnings) add(path string, err error) {
+	kind := "remote"
+	switch {
+	case errors.Is(err, ErrSpecialFile):
+		kind = "special"
+	case errors.Is(err, ErrSymlinkLoop):
+		kind = "loop"
+	case errors.Is(err, os.ErrNotExist):
+		kind = "missing"
+	}
+	*w = append(*w, filepath.Base(path)+":"+kind)
+	sort.Strings(*w)
+}
+
+var linkTests = []struct {
+	mode  SymlinkMode
+	files map[string]string
+	links map[string]string
+}{
+	{
+		mode: FollowSymlinks,
+		files: map[string]string{
+			"a/file.txt": "file",
+			"a/link.txt": "file",
+			"ext/e.txt":  "ext",
+		},
+		links: map[string]string{},
+	},
+	{
+		mode:  SkipSymlinks,
+		files: map[string]string{"a/file.txt": "file"},
+		links: map[string]string{},
+	},
+	{
+		mode:  PreserveSymlinks,
+		files: map[string]string{"a/file.txt": "file"},
+		links: map[string]string{
+			"a/link.txt": "file.txt",
+			"a/up":       "..",
+			"dangling":   "nowhere",
+			"ext":        "../ext",
+		},
+	},
+}
+
+func TestSendDirSymlinks(t *testing.T) {
+	s, client := newTestClient(t)
+	src := makeLinkTree(t, t.TempDir())
+
+	for _, tt := range linkTests {
+		dest := filepath.Join(s.Dir, "dest")
+		os.RemoveAll(dest)
+		var warned warnings
+		c := NewSCP(client)
+		c.Symlinks = tt.mode
+		c.Warn = warned.add
+		if err := c.SendDir(src, dest, nil); err != nil {
+			t.Fatalf("mode %d: %v", tt.mode, err)
+		}
+		if got := readTree(t, dest); !reflect.DeepEqual(got, tt.files) {
+			t.Errorf("mode %d: files = %v, want %v", tt.mode, got, tt.files)
+		}
+		if got := readLinks(t, dest); !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("mode %d: links = %v, want %v", tt.mode, got, tt.links)
+		}
+		want := warnings{"fifo:special"}
+		if tt.mode == FollowSymlinks {
+			want = warnings{"dangling:missing", "fifo:special", "up:loop"}
+		}
+		if !reflect.DeepEqual(warned, want) {
+			t.Errorf("mode %d: warnings = %v, want %v", tt.mode, warned, want)
+		}
+	}
+}
+
+func TestReceiveDirSymlinks(t *testing.T) {
+	s, client := newTestClient(t)
+	src := makeLinkTree(t, s.Dir)
+
+	for _, tt := range linkTests {
+		dest := filepath.Join(t.TempDir(), "dest")
+		var warned warnings
+		c := NewSCP(client)
+		c.Symlinks = tt.mode
+		c.Warn = warned.add
+		if err := c.ReceiveDir(src, dest, nil); err != nil {
+			t.Fatalf("mode %d: %v", tt.mode, err)
+		}
+		if got := readTree(t, dest); !reflect.DeepEqual(got, tt.files) {
+			t.Errorf("mode %d: files = %v, want %v", tt.mode, got, tt.files)
+		}
+		if got := readLinks(t, dest); !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("mode %d: links = %v, want %v", tt.mode, got, tt.links)
+		}
+		// the remote scp reports the FIFO and the dangling link as errors
+		want := warnings{"src:remote"}
+		if tt.mode == FollowSymlinks {
+			want = warnings{"src:remote", "src:remote", "up:loop"}
+		}
+		if !reflect.DeepEqual(warned, want) {
+			t.Errorf("mode %d: warnings = %v, want %v", tt.mode, warned, want)
+		}
+	}
+}
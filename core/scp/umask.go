@@ -0,0 +1,18 @@
+// +build !windows
+
+package scp
+
+import (
+	"os"
+	"syscall"
+)
+
+// localUmask is the umask of the process, read once at startup because
+// syscall.Umask can only read it by changing it.
+var localUmask = readUmask()
+
+func readUmask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
@@ -0,0 +1,8 @@
+// +build windows
+
+package scp
+
+import "os"
+
+// localUmask is always zero, Windows has no umask.
+var localUmask os.FileMode
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// 选择条件的操作类型
+const (
+	selectorEqual = iota
+	selectorNotEqual
+	selectorExists
+	selectorNotExists
+)
+
+type selectorTerm struct {
+	key    string
+	op     int
+	values []string
+}
+
+//Selector 标签选择器，格式如：role=db,env!=prod,region=sh|bj,name=web*,backup,!deprecated
+//多个条件之间为“且”，值支持用|分隔多个候选以及通配符*?
+//除标签外还可以使用name、ip、user、group（分组名称）进行选择
+type Selector struct {
+	terms []selectorTerm
+}
+
+//ParseSelector 解析选择器，空字符串匹配所有服务
+func ParseSelector(s string) (*Selector, error) {
+	sel := &Selector{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var term selectorTerm
+		if i := strings.Index(part, "!="); i >= 0 {
+			term = selectorTerm{key: part[:i], op: selectorNotEqual, values: strings.Split(part[i+2:], "|")}
+		} else if i := strings.Index(part, "="); i >= 0 {
+			term = selectorTerm{key: part[:i], op: selectorEqual, values: strings.Split(strings.TrimPrefix(part[i+1:], "="), "|")}
+		} else if strings.HasPrefix(part, "!") {
+			term = selectorTerm{key: part[1:], op: selectorNotExists}
+		} else {
+			term = selectorTerm{key: part, op: selectorExists}
+		}
+
+		term.key = strings.TrimSpace(term.key)
+		if term.key == "" {
+			return nil, errors.New("选择条件缺少标签名：" + part)
+		}
+		for i, v := range term.values {
+			v = strings.TrimSpace(v)
+			if _, err := path.Match(v, ""); err != nil {
+				return nil, errors.New("选择条件格式错误：" + part)
+			}
+			term.values[i] = v
+		}
+		sel.terms = append(sel.terms, term)
+	}
+	return sel, nil
+}
+
+//Empty 是否没有任何条件
+func (sel *Selector) Empty() bool {
+	return sel == nil || len(sel.terms) == 0
+}
+
+//Match 判断标签是否满足所有条件
+func (sel *Selector) Match(labels map[string]string) bool {
+	if sel == nil {
+		return true
+	}
+	for _, term := range sel.terms {
+		v, ok := labels[term.key]
+		switch term.op {
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		case selectorEqual:
+			if !ok || !matchAny(term.values, v) {
+				return false
+			}
+		case selectorNotEqual:
+			if ok && matchAny(term.values, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//MatchServer 判断服务是否满足条件
+func (sel *Selector) MatchServer(server *Server) bool {
+	return sel.Match(server.selectorLabels())
+}
+
+// 通配符匹配，与path.Match不同的是*也匹配/，使group=prod*包含prod的子分组
+func matchAny(patterns []string, v string) bool {
+	v = strings.ReplaceAll(v, "/", "\x00")
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ReplaceAll(p, "/", "\x00"), v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//SelectServers 按选择器查找服务
+func (app *App) SelectServers(selector string) ([]*Server, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.Load(); err != nil {
+		return nil, err
+	}
+
+	var servers []*Server
+	app.eachServer(func(flag string, scope *groupScope, conf *Server) {
+		if server := app.serverIndex[flag].server; sel.MatchServer(server) {
+			servers = append(servers, server)
+		}
+	})
+	if len(servers) == 0 {
+		return nil, errors.New("没有匹配的服务：" + selector)
+	}
+	return servers, nil
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{"", "role=db", "env!=prod,region=sh|bj", "name=web*", "backup,!deprecated", "name=[a-c]?"} {
+		if _, err := ParseSelector(s); err != nil {
+			t.Errorf("ParseSelector(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"=db", "!=prod", "!", "name=[a"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) should fail", s)
+		}
+	}
+	sel, _ := ParseSelector(" , ")
+	if !sel.Empty() {
+		t.Fatal("blank selector should be empty")
+	}
+}
+
+func TestMatchServer(t *testing.T) {
+	conf := `{
+		"servers": [{"name": "web1", "ip": "10.0.0.1", "user": "root", "tags": {"role": "web", "env": "prod"}}],
+		"groups": [{
+			"group_name": "prod", "prefix": "p", "tags": {"env": "prod"},
+			"servers": [{"name": "db1", "ip": "10.0.1.1", "user": "mysql", "tags": {"role": "db", "backup": "yes"}}],
+			"groups": [{
+				"group_name": "child", "prefix": "c",
+				"servers": [
+					{"name": "db2", "ip": "10.0.2.1", "user": "mysql", "tags": {"role": "db"}},
+					{"name": "web2", "ip": "10.0.2.2", "user": "root", "tags": {"role": "web", "env": "test", "deprecated": "1"}}
+				]
+			}]
+		}, {
+			"group_name": "production", "prefix": "x",
+			"servers": [{"name": "cache1", "ip": "10.1.0.1", "user": "redis"}]
+		}]
+	}`
+	name := filepath.Join(t.TempDir(), "al.conf")
+	if err := ioutil.WriteFile(name, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{ConfigPath: name}
+	if err := app.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"", "cache1,db1,db2,web1,web2"},
+		{"role=db", "db1,db2"},
+		{"role=db|web", "db1,db2,web1,web2"},
+		{"role!=db", "cache1,web1,web2"},
+		{"env=prod,role=web", "web1"},
+		{"env!=prod", "cache1,web2"},
+		{"backup", "db1"},
+		{"!deprecated,role=web", "web1"},
+		{"name=web*", "web1,web2"},
+		{"name=db?", "db1,db2"},
+		{"ip=10.0.*", "db1,db2,web1,web2"},
+		{"user=mysql", "db1,db2"},
+		{"group=prod", "db1"},
+		{"group=prod/child", "db2,web2"},
+		{"group=prod/*", "db2,web2"},
+		{"group=prod*", "cache1,db1,db2,web2"},
+		{"group=*child", "db2,web2"},
+		{"group!=prod*", "web1"},
+		{"group=?*,role=web", "web2"},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.selector, err)
+		}
+		var got []string
+		for _, entry := range app.serverIndex {
+			if sel.MatchServer(entry.server) {
+				got = append(got, entry.server.Name)
+			}
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%q matched %v, want %s", tt.selector, got, tt.want)
+		}
+	}
+}
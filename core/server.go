@@ -1,7 +1,9 @@
 package core
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io"
 	"net"
 	"os"
 	"strconv"
@@ -20,10 +22,43 @@ type Server struct {
 	Password string                 `json:"password"`
 	Method   string                 `json:"method"`
 	Key      string                 `json:"key"`
+	Jump     string                 `json:"jump,omitempty"`
 	Options  map[string]interface{} `json:"options"`
+	Tags     map[string]string      `json:"tags,omitempty"`
+	Expect   []ExpectRule           `json:"expect,omitempty"`
 
 	termWidth  int
 	termHeight int
+	group      string
+	groupTags  map[string]string
+	jump       *Server
+	recorder   *Recorder
+}
+
+//Labels 服务标签，包含从分组继承的标签，服务自身的标签优先
+func (server *Server) Labels() map[string]string {
+	labels := make(map[string]string)
+	for k, v := range server.groupTags {
+		labels[k] = v
+	}
+	for k, v := range server.Tags {
+		labels[k] = v
+	}
+	return labels
+}
+
+// 选择器使用的标签，包含name、ip、user、group
+func (server *Server) selectorLabels() map[string]string {
+	labels := map[string]string{
+		"name":  server.Name,
+		"ip":    server.IP,
+		"user":  server.User,
+		"group": server.group,
+	}
+	for k, v := range server.Labels() {
+		labels[k] = v
+	}
+	return labels
 }
 
 //Format 格式化
@@ -37,7 +72,19 @@ func (server *Server) Format() {
 	}
 }
 
+//GenClient 建立ssh连接，失败时返回的错误类型：ErrAuthFailed、ErrHostUnreachable、ErrHostKeyMismatch、ErrHostKeyUnknown
 func (server *Server) GenClient() (*ssh.Client, error) {
+	return server.GenClientContext(context.Background())
+}
+
+//GenClientContext 建立ssh连接，ctx取消或超时时停止连接（包括跳板机）
+//设置了ConnectTimeout选项（秒）时，连接和握手超过这个时间后返回ErrHostUnreachable
+func (server *Server) GenClientContext(ctx context.Context) (*ssh.Client, error) {
+	if n, ok := server.Options["ConnectTimeout"].(float64); ok && n > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(n*float64(time.Second)))
+		defer cancel()
+	}
 	pw := server.Password
 	key := server.Key
 	if server.Method == "k" {
@@ -46,7 +93,6 @@ func (server *Server) GenClient() (*ssh.Client, error) {
 		if pw != "" {
 			passwd, err := Decrypt(pw)
 			if err != nil {
-				Errorln("密码解析错误:", err)
 				Log.Error("密码解析错误:", err)
 				passwd = server.Password
 			}
@@ -56,17 +102,19 @@ func (server *Server) GenClient() (*ssh.Client, error) {
 	auths, err := ParseAuthMethods(pw, key)
 
 	if err != nil {
-		Errorln("鉴权出错:", err)
 		Log.Error("auth fail", err)
-		return nil, err
+		return nil, newError(ErrAuthFailed, server.Name, err)
 	}
 
+	var keyErr error
+	hostKeyCallback, err := server.hostKeyCallback(&keyErr)
+	if err != nil {
+		return nil, err
+	}
 	config := &ssh.ClientConfig{
-		User: server.User,
-		Auth: auths,
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		},
+		User:            server.User,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
 	}
 
 	// 默认端口为22
@@ -75,32 +123,125 @@ func (server *Server) GenClient() (*ssh.Client, error) {
 	}
 
 	addr := server.IP + ":" + strconv.Itoa(server.Port)
-	client, err := ssh.Dial("tcp", addr, config)
+	client, err := server.dial(ctx, addr, config)
 	if err != nil {
-		if ErrorAssert(err, "ssh: unable to authenticate") {
-			Errorln("连接失败，请检查密码/密钥是否有误")
+		Log.Error("ssh dial fail", server.Name, err)
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		return nil, server.dialError(err)
+	}
+	return client, nil
+}
+
+// 按失败原因转换连接错误，跳板机的错误已经转换过
+func (server *Server) dialError(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if ErrorAssert(err, "ssh: unable to authenticate") {
+		return newError(ErrAuthFailed, server.Name, err)
+	}
+	return newError(ErrHostUnreachable, server.Name, err)
+}
+
+// 建立ssh连接，配置了跳板机时通过跳板机转发
+func (server *Server) dial(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var jumpClient *ssh.Client
+	var err error
+	if server.jump == nil {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		Log.Info("connect", server.Name, "via jump", server.jump.Name)
+		jumpClient, err = server.jump.GenClientContext(ctx)
+		if err != nil {
 			return nil, err
 		}
-		Errorln("ssh dial fail:", err)
-		Log.Error("ssh dial fail", err)
-		return nil, err
+		stop := closeOnDone(ctx, jumpClient)
+		conn, err = jumpClient.Dial("tcp", addr)
+		stop()
+		if err != nil {
+			jumpClient.Close()
+		}
+	}
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	// 握手期间取消时关闭连接
+	stop := closeOnDone(ctx, conn)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	stop()
+	if err != nil {
+		conn.Close()
+		if jumpClient != nil {
+			jumpClient.Close()
+		}
+		return nil, contextError(ctx, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	if jumpClient != nil {
+		// 目标连接关闭后关闭跳板机连接
+		go func() {
+			client.Wait()
+			jumpClient.Close()
+		}()
 	}
 	return client, nil
 }
 
-//Connect 执行远程连接
-func (server *Server) Connect() {
+// ctx取消时关闭c，返回停止监听的函数
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// ctx已取消时返回ctx的错误，代替关闭连接导致的错误
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+//ReconnectAttempts 连接意外断开后的重连次数，未设置AutoReconnect时为0
+func (server *Server) ReconnectAttempts() int {
+	if reconnect, _ := server.Options["AutoReconnect"].(bool); !reconnect {
+		return 0
+	}
+	if n, ok := server.Options["ReconnectAttempts"].(float64); ok && n > 0 {
+		return int(n)
+	}
+	return 3
+}
+
+//Connect 登录服务器并打开终端，会话结束后返回
+//连接意外断开（网络中断、心跳超时）时返回ErrConnectionLost，可以按ReconnectAttempts重新连接
+func (server *Server) Connect() error {
 	client, err := server.GenClient()
+	AuditLogin(server, err)
 	if err != nil {
-		return
+		return err
 	}
 	defer client.Close()
+	start := time.Now()
 
 	session, err := client.NewSession()
 	if err != nil {
-		Errorln("create session fail:", err)
 		Log.Error("create session fail", err)
-		return
+		return newError(ErrHostUnreachable, server.Name, err)
 	}
 
 	defer session.Close()
@@ -108,98 +249,161 @@ func (server *Server) Connect() {
 	fd := int(os.Stdin.Fd())
 	oldState, err := term.MakeRaw(fd)
 	if err != nil {
-		Errorln("创建文件描述符出错:", err)
 		Log.Error("创建文件描述符出错", err)
-		return
+		return errors.New("创建文件描述符出错：" + err.Error())
 	}
 
-	stopKeepAliveLoop := server.startKeepAliveLoop(session)
-	defer close(stopKeepAliveLoop)
+	keepAlive := server.startKeepAlive(client)
+	defer keepAlive.stop()
 
+	done := make(chan struct{})
+	defer close(done)
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
-	session.Stdin = os.Stdin
+	session.Stdin = stdinInput.reader(done)
 
 	defer term.Restore(fd, oldState)
 
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
+	server.termWidth, server.termHeight, _ = term.GetSize(fd)
+	if record, _ := server.Options["Record"].(bool); record {
+		if err := server.startRecord(session); err != nil {
+			return err
+		}
+		defer server.stopRecord()
 	}
 
-	server.termWidth, server.termHeight, _ = term.GetSize(fd)
-	if err := session.RequestPty("xterm-256color", server.termHeight, server.termWidth, modes); err != nil {
-		Errorln("创建终端出错:", err)
+	modes := server.terminalModes()
+
+	if err := session.RequestPty(server.termType(), server.termHeight, server.termWidth, modes); err != nil {
 		Log.Error("创建终端出错", err)
-		return
+		return errors.New("创建终端出错：" + err.Error())
 	}
 
-	winChange := server.listenWindowChange(session, fd)
-	defer close(winChange)
+	stopWindowChange := server.listenWindowChange(session, fd)
+	defer stopWindowChange()
+
+	server.forwardAgent(client, session)
+	server.forwardX11(client, session)
+
+	cmds := append(server.setEnv(session), server.startupCommands()...)
+	fw := newForwards(client)
+	defer fw.close()
+	var received int64
+	session.Stdout = io.MultiWriter(session.Stdout, countWriter{&received})
+	input := server.escapeReader(session.Stdin, client, fw, os.Stdout, &received)
+	session.Stdin = nil
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		Log.Error("创建输入出错", err)
+		return errors.New("创建输入出错：" + err.Error())
+	}
+	w := &lockedWriter{w: stdin}
+	var ready <-chan struct{}
+	if e := server.expecter(w, os.Stdout); e != nil {
+		session.Stdout = io.MultiWriter(session.Stdout, e)
+		ready = e.Done()
+		defer e.finish()
+	}
 
-	err = session.Shell()
+	if remote, _ := server.Options["RemoteCommand"].(string); remote != "" {
+		Log.Info("remote command", remote)
+		err = session.Start(remote)
+	} else {
+		err = session.Shell()
+	}
 	if err != nil {
-		Errorln("执行Shell出错:", err)
 		Log.Error("执行Shell出错", err)
-		return
+		return errors.New("执行Shell出错：" + err.Error())
 	}
+	go writeInput(w, cmds, input, ready)
 
 	err = session.Wait()
+	code := 0
+	dropped := false
+	switch e := err.(type) {
+	case nil:
+	case *ssh.ExitError:
+		code = e.ExitStatus()
+	default:
+		code = -1
+		// 不是使用 ~. 主动断开的
+		esc, ok := input.(*escapeReader)
+		dropped = !ok || !esc.isClosed()
+	}
+	AuditLogout(server, start, code)
 	if err != nil {
-		//Errorln("执行Wait出错:", err)
 		Log.Error("执行Wait出错", err)
-		return
 	}
+	if keepAlive.isDead() {
+		return newError(ErrConnectionLost, server.Name, errors.New("服务器没有响应"))
+	}
+	if dropped {
+		return newError(ErrConnectionLost, server.Name, err)
+	}
+	return nil
 }
 
-// 监听终端窗口变化
-func (server *Server) listenWindowChange(session *ssh.Session, fd int) chan struct{} {
-	terminate := make(chan struct{})
-	go func() {
-		for {
-			select {
-			case <-terminate:
-				return
-			default:
-				termWidth, termHeight, _ := term.GetSize(fd)
-
-				if server.termWidth != termWidth || server.termHeight != termHeight {
-					server.termHeight = termHeight
-					server.termWidth = termWidth
-					session.WindowChange(termHeight, termWidth)
-				}
+// 开始录像，输出写入录像文件，RecordInput为true时同时记录键盘输入
+// 输入默认不记录：sudo、su等提示符下输入的密码不会回显，但会以明文出现在输入事件中
+func (server *Server) startRecord(session *ssh.Session) error {
+	path := recordPath(server)
+	rec, err := NewRecorder(path, server.termWidth, server.termHeight, server.Name+" "+server.User+"@"+server.IP)
+	if err != nil {
+		Log.Error("创建录像文件出错", err)
+		return errors.New("创建录像文件出错：" + err.Error())
+	}
+	Log.Info("record", server.Name, "to", path)
+	server.recorder = rec
 
-				time.Sleep(time.Millisecond * 3)
-			}
-		}
-	}()
+	session.Stdout = io.MultiWriter(os.Stdout, rec.Output())
+	session.Stderr = io.MultiWriter(os.Stderr, rec.Output())
+	if input, _ := server.Options["RecordInput"].(bool); input {
+		session.Stdin = io.TeeReader(session.Stdin, rec.Input())
+	}
+	return nil
+}
 
-	return terminate
+func (server *Server) stopRecord() {
+	if server.recorder != nil {
+		server.recorder.Close()
+		server.recorder = nil
+	}
 }
 
-// 发送心跳包
-func (server *Server) startKeepAliveLoop(session *ssh.Session) chan struct{} {
-	terminate := make(chan struct{})
+// 监听终端窗口变化，大小改变时调用fn，返回停止监听的函数
+func watchWindowSize(fd, width, height int, fn func(width, height int)) func() {
+	changes, stopChanges := windowChanges()
+	done := make(chan struct{})
 	go func() {
 		for {
 			select {
-			case <-terminate:
+			case <-done:
 				return
-			default:
-				if val, ok := server.Options["ServerAliveInterval"]; ok && val != nil {
-					_, err := session.SendRequest("kl@licl", true, nil)
-					if err != nil {
-						Log.Error("keepAliveLoop fail", err)
-					}
-					// Log.Info("kl....")
-					t := time.Duration(server.Options["ServerAliveInterval"].(float64))
-					time.Sleep(time.Second * t)
+			case <-changes:
+				w, h, err := term.GetSize(fd)
+				if err != nil || (w == width && h == height) {
+					continue
 				}
+				width, height = w, h
+				fn(w, h)
 			}
 		}
 	}()
-	return terminate
+	return func() {
+		stopChanges()
+		close(done)
+	}
+}
+
+// 窗口大小改变时通知远程终端，并记录到录像
+func (server *Server) listenWindowChange(session *ssh.Session, fd int) func() {
+	rec := server.recorder
+	return watchWindowSize(fd, server.termWidth, server.termHeight, func(width, height int) {
+		session.WindowChange(height, width)
+		if rec != nil {
+			rec.Resize(width, height)
+		}
+	})
 }
 
 //MergeOptions 合并选项
@@ -219,57 +423,3 @@ func (server *Server) MergeOptions(options map[string]interface{}, overwrite boo
 
 	}
 }
-
-//Edit 编辑服务配置
-func (server *Server) Edit() {
-	input := ""
-	Info("Name(default=" + server.Name + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.Name = input
-		input = ""
-	}
-
-	Info("Ip(default=" + server.IP + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.IP = input
-		input = ""
-	}
-
-	Info("Port(default=" + strconv.Itoa(server.Port) + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		port, _ := strconv.Atoi(input)
-		server.Port = port
-		input = ""
-	}
-
-	Info("User(default=" + server.User + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.User = input
-		input = ""
-	}
-
-	Info("Password(default=" + server.Password + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.Password = input
-		input = ""
-	}
-
-	Info("Method(default=" + server.Method + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.Method = input
-		input = ""
-	}
-
-	Info("Key(default=" + server.Key + ")：")
-	fmt.Scanln(&input)
-	if input != "" {
-		server.Key = input
-		input = ""
-	}
-}
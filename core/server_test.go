@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gssh/core/sshtest"
+)
+
+// 启动测试服务，返回使用密码登录的Server，密码和配置文件中一样是加密的
+func newTestServer(t *testing.T) (*sshtest.Server, *Server) {
+	t.Helper()
+	ts, err := sshtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ts.Close() })
+	password, err := Encrypt(ts.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Name:     "test",
+		IP:       ts.Host(),
+		Port:     ts.Port(),
+		User:     ts.User,
+		Password: password,
+		Options:  map[string]interface{}{},
+	}
+	server.Format()
+	return ts, server
+}
+
+func dialTest(t *testing.T, server *Server) *Client {
+	t.Helper()
+	client, err := server.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGenClientPassword(t *testing.T) {
+	_, server := newTestServer(t)
+	client, err := server.GenClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestGenClientKey(t *testing.T) {
+	ts, server := newTestServer(t)
+	server.Method, server.Password, server.Key = "k", "", ts.ClientKeyFile
+	client, err := server.GenClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+func TestGenClientAuthFailed(t *testing.T) {
+	_, server := newTestServer(t)
+	server.Password = "wrong"
+	_, err := server.GenClient()
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestGenClientUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+	server := &Server{Name: "down", IP: "127.0.0.1", Port: addr.Port, User: "test", Password: "test"}
+	_, err = server.GenClient()
+	if !errors.Is(err, ErrHostUnreachable) {
+		t.Fatalf("err = %v, want ErrHostUnreachable", err)
+	}
+}
+
+func TestGenClientContextCanceled(t *testing.T) {
+	// 只接受连接不握手的服务，连接会一直等待
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	server := &Server{Name: "hang", IP: "127.0.0.1", Port: addr.Port, User: "test", Password: "test"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = server.GenClientContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestHostKeyChecking(t *testing.T) {
+	ts, server := newTestServer(t)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	server.Options["UserKnownHostsFile"] = knownHosts
+
+	server.Options["StrictHostKeyChecking"] = "yes"
+	if _, err := server.GenClient(); !errors.Is(err, ErrHostKeyUnknown) {
+		t.Fatalf("yes: err = %v, want ErrHostKeyUnknown", err)
+	}
+
+	server.Options["StrictHostKeyChecking"] = "accept-new"
+	client, err := server.GenClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	data, err := ioutil.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), ts.HostKey.Type()) {
+		t.Fatalf("known_hosts = %q", data)
+	}
+
+	server.Options["StrictHostKeyChecking"] = "yes"
+	client, err = server.GenClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// 另一个服务使用同一个地址记录，公钥不一致
+	other, err := sshtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	line := strings.Replace(string(data), "["+ts.Host()+"]:"+strconv.Itoa(ts.Port()), "["+other.Host()+"]:"+strconv.Itoa(other.Port()), 1)
+	if err := ioutil.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server.Port = other.Port()
+	if _, err := server.GenClient(); !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("err = %v, want ErrHostKeyMismatch", err)
+	}
+}
@@ -0,0 +1,161 @@
+package sshtest
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 本地转发：连接客户端指定的地址，双向复制数据
+func handleDirect(nc ssh.NewChannel) {
+	var msg struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &msg); err != nil {
+		nc.Reject(ssh.ConnectionFailed, "bad direct-tcpip request")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port))))
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+// 双向复制，任意一方结束后关闭两端
+func pipe(ch ssh.Channel, conn net.Conn) {
+	var once sync.Once
+	closeAll := func() {
+		ch.Close()
+		conn.Close()
+	}
+	go func() {
+		io.Copy(ch, conn)
+		once.Do(closeAll)
+	}()
+	io.Copy(conn, ch)
+	once.Do(closeAll)
+}
+
+// 一个连接的远程转发监听
+type remoteForwards struct {
+	conn *ssh.ServerConn
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+}
+
+type forwardRequest struct {
+	Host string
+	Port uint32
+}
+
+// 处理全局请求：tcpip-forward、cancel-tcpip-forward，其他（例如keepalive）回复失败
+func (f *remoteForwards) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			var msg forwardRequest
+			if ssh.Unmarshal(req.Payload, &msg) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			port, err := f.listen(msg)
+			if err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			var reply []byte
+			if msg.Port == 0 {
+				reply = ssh.Marshal(&struct{ Port uint32 }{port})
+			}
+			req.Reply(true, reply)
+		case "cancel-tcpip-forward":
+			var msg forwardRequest
+			if ssh.Unmarshal(req.Payload, &msg) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(f.cancel(msg), nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (f *remoteForwards) listen(msg forwardRequest) (uint32, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port))))
+	if err != nil {
+		return 0, err
+	}
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+	f.mu.Lock()
+	f.listeners[net.JoinHostPort(msg.Host, strconv.Itoa(int(port)))] = l
+	f.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.forward(msg.Host, port, conn)
+		}
+	}()
+	return port, nil
+}
+
+// 把监听到的连接通过forwarded-tcpip通道交给客户端
+func (f *remoteForwards) forward(host string, port uint32, conn net.Conn) {
+	origin := conn.RemoteAddr().(*net.TCPAddr)
+	payload := ssh.Marshal(&struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}{host, port, origin.IP.String(), uint32(origin.Port)})
+	ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", payload)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+func (f *remoteForwards) cancel(msg forwardRequest) bool {
+	key := net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port)))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, ok := f.listeners[key]
+	if !ok {
+		return false
+	}
+	l.Close()
+	delete(f.listeners, key)
+	return true
+}
+
+func (f *remoteForwards) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, l := range f.listeners {
+		l.Close()
+		delete(f.listeners, key)
+	}
+}
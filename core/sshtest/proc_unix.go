@@ -0,0 +1,32 @@
+// +build !windows
+
+package sshtest
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// 命令在单独的进程组中执行，信号发送给整个进程组
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalProcess(cmd *exec.Cmd, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return errors.New("unknown signal: " + name)
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
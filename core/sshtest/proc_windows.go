@@ -0,0 +1,15 @@
+// +build windows
+
+package sshtest
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// windows不支持信号，直接结束进程
+func signalProcess(cmd *exec.Cmd, name string) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,402 @@
+package sshtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scp命令的参数，只支持 -t（接收）、-f（发送）、-r、-p、-d
+type scpArgs struct {
+	sink      bool
+	source    bool
+	recursive bool
+	preserve  bool
+	path      string
+}
+
+// 解析scp命令，不是scp命令时返回false
+func parseSCP(command string) (*scpArgs, bool) {
+	words, err := shellWords(command)
+	if err != nil || len(words) < 2 || words[0] != "scp" {
+		return nil, false
+	}
+	args := &scpArgs{}
+	for _, w := range words[1 : len(words)-1] {
+		if w == "--" {
+			continue
+		}
+		if !strings.HasPrefix(w, "-") {
+			return nil, false
+		}
+		for _, c := range w[1:] {
+			switch c {
+			case 't':
+				args.sink = true
+			case 'f':
+				args.source = true
+			case 'r':
+				args.recursive = true
+			case 'p':
+				args.preserve = true
+			case 'd':
+			default:
+				return nil, false
+			}
+		}
+	}
+	if args.sink == args.source {
+		return nil, false
+	}
+	args.path = words[len(words)-1]
+	return args, true
+}
+
+// 执行scp，返回退出码
+func (s *Server) runSCP(args *scpArgs, in io.Reader, out io.Writer) int {
+	name := args.path
+	if name == "~" || strings.HasPrefix(name, "~/") {
+		name = filepath.Join(s.Dir, name[1:])
+	} else if !filepath.IsAbs(name) {
+		name = filepath.Join(s.Dir, name)
+	}
+	c := &scpConn{in: bufio.NewReader(in), out: out, preserve: args.preserve}
+	var err error
+	if args.sink {
+		err = c.sink(name)
+	} else {
+		err = c.source(name, args.recursive)
+	}
+	if err != nil {
+		if err != errRemote {
+			fmt.Fprintf(out, "\x01scp: %v\n", err)
+		}
+		return 1
+	}
+	if c.warned {
+		return 1
+	}
+	return 0
+}
+
+// 对方发送了错误，不需要再回复
+var errRemote = errors.New("scp: remote error")
+
+type scpConn struct {
+	in       *bufio.Reader
+	out      io.Writer
+	preserve bool
+	// 跳过了文件，退出码为1
+	warned bool
+}
+
+// 和OpenSSH一样报告跳过的文件，然后继续发送
+func (c *scpConn) warn(name string, err error) {
+	c.warned = true
+	fmt.Fprintf(c.out, "\x01scp: %s: %v\n", name, err)
+}
+
+func (c *scpConn) ok() error {
+	_, err := c.out.Write([]byte{0})
+	return err
+}
+
+// 读取对方的回复
+func (c *scpConn) reply() error {
+	b, err := c.in.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := c.in.ReadString('\n')
+	return errors.New(strings.TrimSpace(msg))
+}
+
+// 接收文件（scp -t），target为已存在的目录时写入其中，否则作为文件或目录名
+func (c *scpConn) sink(target string) error {
+	if err := c.ok(); err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	targetIsDir := err == nil && fi.IsDir()
+
+	var dirs []scpDir
+	var mtime, atime time.Time
+	hasTime := false
+	for {
+		line, err := c.in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return errors.New("empty message")
+		}
+
+		switch line[0] {
+		case 0:
+			// 上一个文件结束后对方的回复
+			continue
+		case '\x01', '\x02':
+			return errRemote
+		case 'T':
+			var ms, mus, as, aus int64
+			if _, err := fmt.Sscanf(line[1:], "%d %d %d %d", &ms, &mus, &as, &aus); err != nil {
+				return fmt.Errorf("bad time message: %q", line)
+			}
+			mtime, atime, hasTime = time.Unix(ms, mus*1000), time.Unix(as, aus*1000), true
+			if err := c.ok(); err != nil {
+				return err
+			}
+			continue
+		case 'E':
+			if len(dirs) == 0 {
+				return errors.New("unexpected E message")
+			}
+			dirs[len(dirs)-1].finish()
+			dirs = dirs[:len(dirs)-1]
+			if err := c.ok(); err != nil {
+				return err
+			}
+			continue
+		case 'C', 'D':
+		default:
+			return fmt.Errorf("unknown message: %q", line)
+		}
+
+		// 文件名可能包含空格，只拆分前两个字段
+		fields := strings.SplitN(line[1:], " ", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("bad message: %q", line)
+		}
+		perm, err1 := strconv.ParseUint(fields[0], 8, 32)
+		size, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || size < 0 {
+			return fmt.Errorf("bad message: %q", line)
+		}
+		mode, name := os.FileMode(perm), fields[2]
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return fmt.Errorf("bad file name: %q", name)
+		}
+
+		var dest string
+		switch {
+		case len(dirs) > 0:
+			dest = filepath.Join(dirs[len(dirs)-1].path, name)
+		case targetIsDir:
+			dest = filepath.Join(target, name)
+		default:
+			dest = target
+		}
+
+		if line[0] == 'D' {
+			// 和OpenSSH一样，新目录先加上所有者的权限，内容写完后再设置权限和时间
+			d := scpDir{path: dest, mode: mode & os.ModePerm, mtime: mtime, atime: atime, hasTime: hasTime}
+			if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+				d.chmod = c.preserve
+			} else {
+				if err := os.MkdirAll(dest, d.mode|0700); err != nil {
+					return err
+				}
+				d.chmod = c.preserve || d.mode&0700 != 0700
+			}
+			dirs = append(dirs, d)
+			if err := c.ok(); err != nil {
+				return err
+			}
+			hasTime = false
+			continue
+		}
+
+		if err := c.ok(); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode&os.ModePerm)
+		if err != nil {
+			io.CopyN(ioutil.Discard, c.in, size+1)
+			return err
+		}
+		_, err = io.CopyN(f, c.in, size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err := c.reply(); err != nil {
+			return errRemote
+		}
+		// 没有-p时新文件的权限受umask限制，已有文件保持原权限；收到时间就设置
+		if c.preserve {
+			os.Chmod(dest, mode&os.ModePerm)
+		}
+		if hasTime {
+			os.Chtimes(dest, atime, mtime)
+		}
+		hasTime = false
+		if err := c.ok(); err != nil {
+			return err
+		}
+	}
+}
+
+// 正在接收的目录
+type scpDir struct {
+	path         string
+	mode         os.FileMode
+	chmod        bool
+	mtime, atime time.Time
+	hasTime      bool
+}
+
+// 目录接收完成，设置权限和时间
+func (d scpDir) finish() {
+	if d.chmod {
+		os.Chmod(d.path, d.mode)
+	}
+	if d.hasTime {
+		os.Chtimes(d.path, d.atime, d.mtime)
+	}
+}
+
+// 发送文件（scp -f）
+func (c *scpConn) source(name string, recursive bool) error {
+	if err := c.reply(); err != nil {
+		return errRemote
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !recursive {
+		return fmt.Errorf("%s: not a regular file", name)
+	}
+	return c.send(name, fi)
+}
+
+func (c *scpConn) send(name string, fi os.FileInfo) error {
+	if c.preserve {
+		if _, err := fmt.Fprintf(c.out, "T%d 0 %d 0\n", fi.ModTime().Unix(), fi.ModTime().Unix()); err != nil {
+			return err
+		}
+		if err := c.reply(); err != nil {
+			return errRemote
+		}
+	}
+
+	if fi.IsDir() {
+		list, err := ioutil.ReadDir(name)
+		if err != nil {
+			c.warn(name, errors.Unwrap(err))
+			return nil
+		}
+		if _, err := fmt.Fprintf(c.out, "D%04o 0 %s\n", fi.Mode()&os.ModePerm, fi.Name()); err != nil {
+			return err
+		}
+		if err := c.reply(); err != nil {
+			return errRemote
+		}
+		for _, child := range list {
+			path := filepath.Join(name, child.Name())
+			if child.Mode()&os.ModeSymlink != 0 {
+				if child, err = os.Stat(path); err != nil {
+					c.warn(path, errors.Unwrap(err))
+					continue
+				}
+			}
+			if !child.IsDir() && !child.Mode().IsRegular() {
+				c.warn(path, errors.New("not a regular file"))
+				continue
+			}
+			if err := c.send(path, child); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprint(c.out, "E\n"); err != nil {
+			return err
+		}
+		if err := c.reply(); err != nil {
+			return errRemote
+		}
+		return nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(c.out, "C%04o %d %s\n", fi.Mode()&os.ModePerm, fi.Size(), fi.Name()); err != nil {
+		return err
+	}
+	if err := c.reply(); err != nil {
+		return errRemote
+	}
+	if _, err := io.CopyN(c.out, f, fi.Size()); err != nil {
+		return err
+	}
+	if err := c.ok(); err != nil {
+		return err
+	}
+	if err := c.reply(); err != nil {
+		return errRemote
+	}
+	return nil
+}
+
+// 按shell规则拆分命令，支持单引号、双引号和反斜杠
+func shellWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord, quote, escape := false, byte(0), false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case escape:
+			cur.WriteByte(ch)
+			escape = false
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				cur.WriteByte(ch)
+			}
+		case ch == '\\':
+			escape, inWord = true, true
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			} else {
+				cur.WriteByte(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote, inWord = ch, true
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if quote != 0 || escape {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
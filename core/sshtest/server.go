@@ -0,0 +1,257 @@
+//Package sshtest 进程内的ssh测试服务，用于在没有网络和sshd的机器上测试core
+//
+//支持密码和公钥登录、exec（本地sh执行，返回退出码）、pty和shell、scp（Go实现的-t/-f）、
+//sftp子系统（stat、目录列表、读写文件、创建删除）、本地转发（direct-tcpip）和远程转发（tcpip-forward）
+package sshtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//Server ssh测试服务，NewServer创建后立即开始监听，使用完调用Close
+type Server struct {
+	//Addr 监听地址，例如 127.0.0.1:34567
+	Addr string
+	//User 登录用户
+	User string
+	//Password 登录密码
+	Password string
+	//Dir 登录目录，也是$HOME，命令在该目录中执行
+	Dir string
+	//HostKey 服务器公钥，可以写入known_hosts
+	HostKey ssh.PublicKey
+	//ClientKeyFile 可以登录的私钥文件（PEM格式）
+	ClientKeyFile string
+
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	clientKey ssh.PublicKey
+
+	mu       sync.Mutex
+	conns    map[*ssh.ServerConn]bool
+	sessions []*Session
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+//Session 客户端打开过的会话，记录执行的命令、环境变量和终端
+type Session struct {
+	//Command exec请求的命令，shell和子系统为空
+	Command string
+	//Subsystem 请求的子系统，例如sftp
+	Subsystem string
+	//Env env请求设置的环境变量
+	Env map[string]string
+	//Pty 请求的终端，没有请求时为nil
+	Pty *Pty
+}
+
+//Pty 客户端请求的终端，window-change会更新宽高
+type Pty struct {
+	Term   string
+	Width  int
+	Height int
+	Modes  ssh.TerminalModes
+}
+
+//NewServer 在127.0.0.1的随机端口启动测试服务，dir为登录目录，私钥文件也写入该目录
+func NewServer(dir string) (*Server, error) {
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	clientPub, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	keyFile := filepath.Join(dir, "id_test")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		User:          "test",
+		Password:      "test",
+		Dir:           dir,
+		HostKey:       hostSigner.PublicKey(),
+		ClientKeyFile: keyFile,
+		clientKey:     clientPub,
+		conns:         make(map[*ssh.ServerConn]bool),
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	s.config.AddHostKey(hostSigner)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.Addr = s.listener.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+//Host 监听的IP
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+//Port 监听的端口
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+//Close 停止监听并断开所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+//CloseConnections 断开所有连接，但继续监听，用于测试断线重连
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+//Sessions 执行过命令、shell或子系统的会话，按开始顺序
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		c := *sess
+		if sess.Pty != nil {
+			pty := *sess.Pty
+			c.Pty = &pty
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+//Commands 执行过的命令（exec请求），按执行顺序
+func (s *Server) Commands() []string {
+	var list []string
+	for _, sess := range s.Sessions() {
+		if sess.Command != "" {
+			list = append(list, sess.Command)
+		}
+	}
+	return list
+}
+
+func (s *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if conn.User() == s.User && string(password) == s.Password {
+		return nil, nil
+	}
+	return nil, errors.New("password rejected")
+}
+
+func (s *Server) checkPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if conn.User() == s.User && string(key.Marshal()) == string(s.clientKey.Marshal()) {
+		return nil, nil
+	}
+	return nil, errors.New("public key rejected")
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(c)
+		}()
+	}
+}
+
+func (s *Server) handleConn(c net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, s.config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	fwd := &remoteForwards{conn: conn, listeners: make(map[string]net.Listener)}
+	defer fwd.closeAll()
+	go fwd.handleRequests(reqs)
+
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "session":
+			ch, requests, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			go s.handleSession(ch, requests)
+		case "direct-tcpip":
+			go handleDirect(nc)
+		default:
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (s *Server) addSession(sess *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = append(s.sessions, sess)
+}
@@ -0,0 +1,117 @@
+package sshtest
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func dial(t *testing.T, s *Server) *ssh.Client {
+	t.Helper()
+	client, err := ssh.Dial("tcp", s.Addr, &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{ssh.Password(s.Password)},
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestPtyAndEnv(t *testing.T) {
+	s := newServer(t)
+	session, err := dial(t, s).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.Setenv("LANG", "C"); err != nil {
+		t.Fatal(err)
+	}
+	modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.TTY_OP_ISPEED: 14400}
+	if err := session.RequestPty("xterm", 24, 80, modes); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	session.Stdout = &out
+	if err := session.Run("echo $TERM $LANG; echo err >&2"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "xterm C\nerr\n" {
+		t.Fatalf("output = %q", out.String())
+	}
+
+	sessions := s.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("sessions = %v", sessions)
+	}
+	want := Pty{Term: "xterm", Width: 80, Height: 24, Modes: modes}
+	if sessions[0].Pty == nil || !reflect.DeepEqual(*sessions[0].Pty, want) {
+		t.Fatalf("pty = %+v, want %+v", sessions[0].Pty, want)
+	}
+	if sessions[0].Env["LANG"] != "C" {
+		t.Fatalf("env = %v", sessions[0].Env)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	s := newServer(t)
+	session, err := dial(t, s).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.Start("sleep 10"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := session.Signal(ssh.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Signal() != "TERM" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSubsystemRejected(t *testing.T) {
+	s := newServer(t)
+	session, err := dial(t, s).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.RequestSubsystem("netconf"); err == nil {
+		t.Fatal("unknown subsystem accepted")
+	}
+}
+
+func TestShellWords(t *testing.T) {
+	words, err := shellWords(`scp -t -- 'a b'"c"\ d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(words, []string{"scp", "-t", "--", "a bc d"}) {
+		t.Fatalf("words = %q", words)
+	}
+	if _, err := shellWords(`'open`); err == nil {
+		t.Fatal("unterminated quote accepted")
+	}
+}
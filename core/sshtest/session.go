@@ -0,0 +1,236 @@
+package sshtest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 一个session通道，只能执行一次exec或shell
+type session struct {
+	server *Server
+	ch     ssh.Channel
+	record *Session
+
+	mu      sync.Mutex
+	started bool
+	cmd     *exec.Cmd
+	signal  string
+}
+
+func (s *Server) handleSession(ch ssh.Channel, requests <-chan *ssh.Request) {
+	sess := &session{server: s, ch: ch, record: &Session{Env: make(map[string]string)}}
+	defer ch.Close()
+	for req := range requests {
+		ok := sess.handle(req)
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+func (sess *session) handle(req *ssh.Request) bool {
+	s := sess.server
+	switch req.Type {
+	case "env":
+		var msg struct{ Name, Value string }
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false
+		}
+		s.mu.Lock()
+		sess.record.Env[msg.Name] = msg.Value
+		s.mu.Unlock()
+		return true
+	case "pty-req":
+		var msg struct {
+			Term          string
+			Columns, Rows uint32
+			Width, Height uint32
+			Modes         string
+		}
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false
+		}
+		s.mu.Lock()
+		sess.record.Pty = &Pty{Term: msg.Term, Width: int(msg.Columns), Height: int(msg.Rows), Modes: parseModes([]byte(msg.Modes))}
+		s.mu.Unlock()
+		return true
+	case "window-change":
+		var msg struct{ Columns, Rows, Width, Height uint32 }
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sess.record.Pty == nil {
+			return false
+		}
+		sess.record.Pty.Width, sess.record.Pty.Height = int(msg.Columns), int(msg.Rows)
+		return true
+	case "exec":
+		var msg struct{ Command string }
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false
+		}
+		return sess.start(msg.Command)
+	case "shell":
+		return sess.start("")
+	case "subsystem":
+		var msg struct{ Name string }
+		if ssh.Unmarshal(req.Payload, &msg) != nil || msg.Name != "sftp" {
+			return false
+		}
+		return sess.startSFTP()
+	case "signal":
+		var msg struct{ Signal string }
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false
+		}
+		return sess.kill(msg.Signal)
+	default:
+		// auth-agent-req、x11-req等不支持
+		return false
+	}
+}
+
+// 开始执行命令，command为空时执行shell
+func (sess *session) start(command string) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.started {
+		return false
+	}
+	sess.started = true
+	sess.record.Command = command
+	sess.server.addSession(sess.record)
+
+	if args, ok := parseSCP(command); ok {
+		go func() {
+			code := sess.server.runSCP(args, sess.ch, sess.ch)
+			sess.exit(code, "")
+		}()
+		return true
+	}
+
+	s := sess.server
+	cmd := exec.Command("sh")
+	if command != "" {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = s.Dir
+	cmd.Env = []string{"HOME=" + s.Dir, "PWD=" + s.Dir, "USER=" + s.User, "PATH=" + os.Getenv("PATH")}
+	s.mu.Lock()
+	for k, v := range sess.record.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	pty := sess.record.Pty != nil
+	if pty {
+		cmd.Env = append(cmd.Env, "TERM="+sess.record.Pty.Term)
+	}
+	s.mu.Unlock()
+
+	cmd.Stdout = sess.ch
+	cmd.Stderr = sess.ch.Stderr()
+	if pty {
+		// 没有真正的终端，和终端一样把错误输出合并到标准输出
+		cmd.Stderr = sess.ch
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false
+	}
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return false
+	}
+	sess.cmd = cmd
+	go func() {
+		io.Copy(stdin, sess.ch)
+		stdin.Close()
+	}()
+	go func() {
+		err := cmd.Wait()
+		sess.mu.Lock()
+		signal := sess.signal
+		sess.mu.Unlock()
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+			if code >= 0 {
+				signal = ""
+			}
+		} else if err != nil {
+			code = 255
+		}
+		sess.exit(code, signal)
+	}()
+	return true
+}
+
+// 开始sftp子系统
+func (sess *session) startSFTP() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.started {
+		return false
+	}
+	sess.started = true
+	sess.record.Subsystem = "sftp"
+	sess.server.addSession(sess.record)
+	go func() {
+		code := 0
+		if err := sess.server.serveSFTP(sess.ch); err != nil {
+			code = 1
+		}
+		sess.exit(code, "")
+	}()
+	return true
+}
+
+// 按ssh的信号名结束进程
+func (sess *session) kill(name string) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.cmd == nil {
+		return false
+	}
+	if err := signalProcess(sess.cmd, name); err != nil {
+		return false
+	}
+	sess.signal = name
+	return true
+}
+
+// 返回退出码或信号并关闭通道
+func (sess *session) exit(code int, signal string) {
+	if signal != "" {
+		msg := struct {
+			Signal     string
+			CoreDumped bool
+			Error      string
+			Lang       string
+		}{Signal: signal}
+		sess.ch.SendRequest("exit-signal", false, ssh.Marshal(&msg))
+	} else {
+		msg := struct{ Status uint32 }{uint32(code)}
+		sess.ch.SendRequest("exit-status", false, ssh.Marshal(&msg))
+	}
+	sess.ch.CloseWrite()
+	sess.ch.Close()
+}
+
+// 解析pty-req中的终端模式：1字节操作码加4字节值，0结束
+func parseModes(b []byte) ssh.TerminalModes {
+	modes := ssh.TerminalModes{}
+	for len(b) >= 5 && b[0] != 0 {
+		modes[b[0]] = binary.BigEndian.Uint32(b[1:5])
+		b = b[5:]
+	}
+	return modes
+}
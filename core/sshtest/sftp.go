@@ -0,0 +1,451 @@
+package sshtest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sftp版本3的消息类型，见draft-ietf-secsh-filexfer-02
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+// 状态码
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// 打开文件的标志
+const (
+	fxfRead   = 0x01
+	fxfWrite  = 0x02
+	fxfAppend = 0x04
+	fxfCreat  = 0x08
+	fxfTrunc  = 0x10
+	fxfExcl   = 0x20
+)
+
+// 文件属性中的字段
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+// 一次READ最多返回的字节数
+const sftpMaxRead = 32768
+
+// sftp会话，只支持测试需要的操作：stat、目录列表、读写文件、创建删除
+type sftpConn struct {
+	server  *Server
+	handles map[string]*sftpHandle
+	next    int
+}
+
+// 打开的文件或目录，目录的内容在READDIR时一次返回
+type sftpHandle struct {
+	file *os.File
+	dir  string
+	read bool
+}
+
+// 执行sftp子系统直到客户端关闭
+func (s *Server) serveSFTP(rw io.ReadWriter) error {
+	c := &sftpConn{server: s, handles: make(map[string]*sftpHandle)}
+	defer func() {
+		for _, h := range c.handles {
+			if h.file != nil {
+				h.file.Close()
+			}
+		}
+	}()
+	for {
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(rw, head); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		length := binary.BigEndian.Uint32(head)
+		if length == 0 || length > 1<<20 {
+			return errors.New("bad sftp packet length")
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(rw, packet); err != nil {
+			return err
+		}
+		reply := c.handle(packet[0], &sftpReader{b: packet[1:]})
+		if _, err := rw.Write(reply.packet()); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *sftpConn) handle(typ byte, r *sftpReader) *sftpWriter {
+	if typ == fxpInit {
+		w := newSFTPWriter(fxpVersion)
+		w.uint32(3)
+		return w
+	}
+	id := r.uint32()
+	if r.err != nil {
+		return statusReply(id, fxBadMessage, "bad message")
+	}
+	switch typ {
+	case fxpRealpath:
+		name := c.path(r.string())
+		w := newSFTPWriter(fxpName)
+		w.uint32(id)
+		w.uint32(1)
+		w.string(filepath.ToSlash(name))
+		w.string(filepath.ToSlash(name))
+		w.uint32(0)
+		return w
+	case fxpStat, fxpLstat:
+		name := c.path(r.string())
+		stat := os.Stat
+		if typ == fxpLstat {
+			stat = os.Lstat
+		}
+		fi, err := stat(name)
+		if err != nil {
+			return errorReply(id, err)
+		}
+		return attrsReply(id, fi)
+	case fxpFstat:
+		h := c.handles[r.string()]
+		if h == nil || h.file == nil {
+			return statusReply(id, fxFailure, "invalid handle")
+		}
+		fi, err := h.file.Stat()
+		if err != nil {
+			return errorReply(id, err)
+		}
+		return attrsReply(id, fi)
+	case fxpOpen:
+		name, pflags := c.path(r.string()), r.uint32()
+		perm := r.attrs()
+		if r.err != nil {
+			return statusReply(id, fxBadMessage, "bad message")
+		}
+		f, err := os.OpenFile(name, openFlags(pflags), perm)
+		if err != nil {
+			return errorReply(id, err)
+		}
+		return c.handleReply(id, &sftpHandle{file: f})
+	case fxpOpendir:
+		name := c.path(r.string())
+		fi, err := os.Stat(name)
+		if err != nil {
+			return errorReply(id, err)
+		}
+		if !fi.IsDir() {
+			return statusReply(id, fxFailure, "not a directory")
+		}
+		return c.handleReply(id, &sftpHandle{dir: name})
+	case fxpReaddir:
+		h := c.handles[r.string()]
+		if h == nil || h.dir == "" {
+			return statusReply(id, fxFailure, "invalid handle")
+		}
+		if h.read {
+			return statusReply(id, fxEOF, "EOF")
+		}
+		h.read = true
+		f, err := os.Open(h.dir)
+		if err != nil {
+			return errorReply(id, err)
+		}
+		list, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return errorReply(id, err)
+		}
+		w := newSFTPWriter(fxpName)
+		w.uint32(id)
+		w.uint32(uint32(len(list)))
+		for _, fi := range list {
+			w.string(fi.Name())
+			w.string(fi.Mode().String() + " " + fi.Name())
+			w.attrs(fi)
+		}
+		return w
+	case fxpRead:
+		h, offset, length := c.handles[r.string()], r.uint64(), r.uint32()
+		if h == nil || h.file == nil {
+			return statusReply(id, fxFailure, "invalid handle")
+		}
+		if length > sftpMaxRead {
+			length = sftpMaxRead
+		}
+		buf := make([]byte, length)
+		n, err := h.file.ReadAt(buf, int64(offset))
+		if n == 0 && err == io.EOF {
+			return statusReply(id, fxEOF, "EOF")
+		}
+		if n == 0 && err != nil {
+			return errorReply(id, err)
+		}
+		w := newSFTPWriter(fxpData)
+		w.uint32(id)
+		w.string(string(buf[:n]))
+		return w
+	case fxpWrite:
+		h, offset, data := c.handles[r.string()], r.uint64(), r.string()
+		if h == nil || h.file == nil {
+			return statusReply(id, fxFailure, "invalid handle")
+		}
+		if _, err := h.file.WriteAt([]byte(data), int64(offset)); err != nil {
+			return errorReply(id, err)
+		}
+		return statusReply(id, fxOK, "")
+	case fxpClose:
+		handle := r.string()
+		h := c.handles[handle]
+		if h == nil {
+			return statusReply(id, fxFailure, "invalid handle")
+		}
+		delete(c.handles, handle)
+		if h.file != nil {
+			if err := h.file.Close(); err != nil {
+				return errorReply(id, err)
+			}
+		}
+		return statusReply(id, fxOK, "")
+	case fxpRemove:
+		return resultReply(id, os.Remove(c.path(r.string())))
+	case fxpMkdir:
+		name := c.path(r.string())
+		perm := r.attrs()
+		if perm == 0 {
+			perm = 0755
+		}
+		return resultReply(id, os.Mkdir(name, perm))
+	case fxpRmdir:
+		name := c.path(r.string())
+		fi, err := os.Stat(name)
+		if err == nil && !fi.IsDir() {
+			return statusReply(id, fxFailure, "not a directory")
+		}
+		return resultReply(id, os.Remove(name))
+	}
+	return statusReply(id, fxOpUnsupported, "unsupported operation")
+}
+
+// 相对路径在登录目录下
+func (c *sftpConn) path(name string) string {
+	if name == "" || name == "." {
+		return c.server.Dir
+	}
+	if name == "~" || strings.HasPrefix(name, "~/") {
+		name = name[1:]
+	} else if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(c.server.Dir, name)
+}
+
+func (c *sftpConn) handleReply(id uint32, h *sftpHandle) *sftpWriter {
+	c.next++
+	handle := strconv.Itoa(c.next)
+	c.handles[handle] = h
+	w := newSFTPWriter(fxpHandle)
+	w.uint32(id)
+	w.string(handle)
+	return w
+}
+
+func openFlags(pflags uint32) int {
+	flags := os.O_RDONLY
+	switch {
+	case pflags&fxfRead != 0 && pflags&fxfWrite != 0:
+		flags = os.O_RDWR
+	case pflags&fxfWrite != 0:
+		flags = os.O_WRONLY
+	}
+	if pflags&fxfAppend != 0 {
+		flags |= os.O_APPEND
+	}
+	if pflags&fxfCreat != 0 {
+		flags |= os.O_CREATE
+	}
+	if pflags&fxfTrunc != 0 {
+		flags |= os.O_TRUNC
+	}
+	if pflags&fxfExcl != 0 {
+		flags |= os.O_EXCL
+	}
+	return flags
+}
+
+func statusReply(id uint32, code uint32, msg string) *sftpWriter {
+	w := newSFTPWriter(fxpStatus)
+	w.uint32(id)
+	w.uint32(code)
+	w.string(msg)
+	w.string("")
+	return w
+}
+
+func errorReply(id uint32, err error) *sftpWriter {
+	switch {
+	case os.IsNotExist(err):
+		return statusReply(id, fxNoSuchFile, err.Error())
+	case os.IsPermission(err):
+		return statusReply(id, fxPermissionDenied, err.Error())
+	}
+	return statusReply(id, fxFailure, err.Error())
+}
+
+func resultReply(id uint32, err error) *sftpWriter {
+	if err != nil {
+		return errorReply(id, err)
+	}
+	return statusReply(id, fxOK, "")
+}
+
+func attrsReply(id uint32, fi os.FileInfo) *sftpWriter {
+	w := newSFTPWriter(fxpAttrs)
+	w.uint32(id)
+	w.attrs(fi)
+	return w
+}
+
+// 解析请求的字段，出错后返回零值，错误保存在err中
+type sftpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sftpReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err = errors.New("short packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sftpReader) uint64() uint64 {
+	return uint64(r.uint32())<<32 | uint64(r.uint32())
+}
+
+func (r *sftpReader) string() string {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errors.New("short packet")
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+// 读取文件属性，只使用权限
+func (r *sftpReader) attrs() os.FileMode {
+	flags := r.uint32()
+	var perm os.FileMode
+	if flags&attrSize != 0 {
+		r.uint64()
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		perm = os.FileMode(r.uint32()) & os.ModePerm
+	}
+	if flags&attrACModTime != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	return perm
+}
+
+// 生成回复
+type sftpWriter struct {
+	b []byte
+}
+
+func newSFTPWriter(typ byte) *sftpWriter {
+	return &sftpWriter{b: []byte{0, 0, 0, 0, typ}}
+}
+
+func (w *sftpWriter) uint32(v uint32) {
+	w.b = append(w.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *sftpWriter) uint64(v uint64) {
+	w.uint32(uint32(v >> 32))
+	w.uint32(uint32(v))
+}
+
+func (w *sftpWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.b = append(w.b, s...)
+}
+
+// 写入大小、权限（带文件类型）和时间
+func (w *sftpWriter) attrs(fi os.FileInfo) {
+	w.uint32(attrSize | attrPermissions | attrACModTime)
+	w.uint64(uint64(fi.Size()))
+	perm := uint32(fi.Mode() & os.ModePerm)
+	switch {
+	case fi.IsDir():
+		perm |= 0040000
+	case fi.Mode()&os.ModeSymlink != 0:
+		perm |= 0120000
+	case fi.Mode().IsRegular():
+		perm |= 0100000
+	}
+	w.uint32(perm)
+	mtime := uint32(fi.ModTime().Unix())
+	w.uint32(mtime)
+	w.uint32(mtime)
+}
+
+// 加上长度的完整数据包
+func (w *sftpWriter) packet() []byte {
+	binary.BigEndian.PutUint32(w.b, uint32(len(w.b)-4))
+	return w.b
+}
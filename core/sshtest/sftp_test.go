@@ -0,0 +1,159 @@
+package sshtest
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// 测试用的sftp客户端，字段按顺序编码为uint32、uint64或string
+type sftpClient struct {
+	t   *testing.T
+	in  io.Writer
+	out io.Reader
+	id  uint32
+}
+
+func (c *sftpClient) call(typ byte, fields ...interface{}) (byte, *sftpReader) {
+	c.t.Helper()
+	w := newSFTPWriter(typ)
+	if typ != fxpInit {
+		c.id++
+		w.uint32(c.id)
+	}
+	for _, f := range fields {
+		switch v := f.(type) {
+		case uint32:
+			w.uint32(v)
+		case uint64:
+			w.uint64(v)
+		case string:
+			w.string(v)
+		}
+	}
+	if _, err := c.in.Write(w.packet()); err != nil {
+		c.t.Fatal(err)
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(c.out, head); err != nil {
+		c.t.Fatal(err)
+	}
+	packet := make([]byte, binary.BigEndian.Uint32(head))
+	if _, err := io.ReadFull(c.out, packet); err != nil {
+		c.t.Fatal(err)
+	}
+	r := &sftpReader{b: packet[1:]}
+	if packet[0] != fxpVersion && r.uint32() != c.id {
+		c.t.Fatal("reply id mismatch")
+	}
+	return packet[0], r
+}
+
+// 期望返回状态码code
+func (c *sftpClient) status(code uint32, typ byte, fields ...interface{}) {
+	c.t.Helper()
+	rt, r := c.call(typ, fields...)
+	if rt != fxpStatus {
+		c.t.Fatalf("request %d: reply type %d, want status", typ, rt)
+	}
+	if got := r.uint32(); got != code {
+		c.t.Fatalf("request %d: status %d %q, want %d", typ, got, r.string(), code)
+	}
+}
+
+// 期望返回句柄
+func (c *sftpClient) handle(typ byte, fields ...interface{}) string {
+	c.t.Helper()
+	rt, r := c.call(typ, fields...)
+	if rt != fxpHandle {
+		c.t.Fatalf("request %d: reply type %d, want handle", typ, rt)
+	}
+	return r.string()
+}
+
+func TestSFTP(t *testing.T) {
+	s := newServer(t)
+	session, err := dial(t, s).NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	in, _ := session.StdinPipe()
+	out, _ := session.StdoutPipe()
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		t.Fatal(err)
+	}
+	c := &sftpClient{t: t, in: in, out: out}
+
+	if typ, r := c.call(fxpInit, uint32(3)); typ != fxpVersion || r.uint32() != 3 {
+		t.Fatal("bad version reply")
+	}
+	if typ, r := c.call(fxpRealpath, "."); typ != fxpName || r.uint32() != 1 || r.string() != filepath.ToSlash(s.Dir) {
+		t.Fatal("bad realpath reply")
+	}
+
+	// 写入文件，创建时的权限来自属性
+	h := c.handle(fxpOpen, "a.txt", uint32(fxfWrite|fxfCreat|fxfTrunc), uint32(attrPermissions), uint32(0640))
+	c.status(fxOK, fxpWrite, h, uint64(0), "hello")
+	c.status(fxOK, fxpWrite, h, uint64(5), " sftp")
+	c.status(fxOK, fxpClose, h)
+	fi, err := os.Stat(filepath.Join(s.Dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 10 || fi.Mode()&0077 != 0040 {
+		t.Fatalf("written file: size %d, mode %v", fi.Size(), fi.Mode())
+	}
+
+	typ, r := c.call(fxpStat, "a.txt")
+	if typ != fxpAttrs || r.uint32()&attrSize == 0 || r.uint64() != 10 || r.uint32()&0170000 != 0100000 {
+		t.Fatal("bad stat reply")
+	}
+	c.status(fxNoSuchFile, fxpStat, "missing")
+
+	// 读取文件
+	h = c.handle(fxpOpen, "a.txt", uint32(fxfRead), uint32(0))
+	if typ, r := c.call(fxpRead, h, uint64(0), uint32(100)); typ != fxpData || r.string() != "hello sftp" {
+		t.Fatal("bad read reply")
+	}
+	c.status(fxEOF, fxpRead, h, uint64(10), uint32(100))
+	if typ, r := c.call(fxpFstat, h); typ != fxpAttrs || r.uint32() == 0 || r.uint64() != 10 {
+		t.Fatal("bad fstat reply")
+	}
+	c.status(fxOK, fxpClose, h)
+
+	// 目录列表
+	c.status(fxOK, fxpMkdir, "d", uint32(0))
+	h = c.handle(fxpOpendir, ".")
+	typ, r = c.call(fxpReaddir, h)
+	if typ != fxpName {
+		t.Fatalf("readdir reply type %d", typ)
+	}
+	var names []string
+	for n := r.uint32(); n > 0; n-- {
+		names = append(names, r.string())
+		r.string()
+		r.attrs()
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "a.txt" || names[1] != "d" || names[2] != "id_test" {
+		t.Fatalf("readdir names = %q", names)
+	}
+	c.status(fxEOF, fxpReaddir, h)
+	c.status(fxOK, fxpClose, h)
+
+	c.status(fxOK, fxpRemove, "a.txt")
+	c.status(fxOK, fxpRmdir, "d")
+	c.status(fxOpUnsupported, 200)
+	if list, _ := ioutil.ReadDir(s.Dir); len(list) != 1 {
+		t.Fatalf("%d files left", len(list))
+	}
+	sessions := s.Sessions()
+	if len(sessions) != 1 || sessions[0].Subsystem != "sftp" {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"io"
+	"regexp"
+	"sort"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SetEnv的变量名，不需要引号，可以直接写在export命令中
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//ExecThenShell 先执行命令，再进入登录shell，用于 gal -exec
+func ExecThenShell(cmd string) string {
+	return cmd + `; exec "${SHELL:-/bin/sh}" -l`
+}
+
+// 转发本地的LANG、LC_*等环境变量，再设置SetEnv中的环境变量，SetEnv服务端不接受（sshd未配置AcceptEnv）时返回export命令，登录后在shell中执行
+func (server *Server) setEnv(session *ssh.Session) []string {
+	server.sendEnv(session)
+
+	env, _ := server.Options["SetEnv"].(map[string]interface{})
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var exports []string
+	for _, k := range keys {
+		if !envKeyPattern.MatchString(k) {
+			Log.Error("invalid SetEnv name, skipped", k)
+			continue
+		}
+		v, _ := env[k].(string)
+		if err := session.Setenv(k, v); err != nil {
+			Log.Info("setenv rejected, use export", k)
+			exports = append(exports, "export "+k+"="+ShellQuote(v))
+		}
+	}
+	return exports
+}
+
+// 检查SetEnv选项的变量名
+func checkSetEnv(v interface{}) []string {
+	m, _ := v.(map[string]interface{})
+	var problems []string
+	for k := range m {
+		if !envKeyPattern.MatchString(k) {
+			problems = append(problems, "环境变量名无效，只能包含字母、数字和下划线，不能以数字开头："+k)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// 登录后依次执行的命令
+func (server *Server) startupCommands() []string {
+	list, _ := server.Options["StartupCommands"].([]interface{})
+	var cmds []string
+	for _, item := range list {
+		if cmd, ok := item.(string); ok && cmd != "" {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// 转发键盘输入，ready关闭后（自动应答结束）写入登录命令，ready为nil时立即写入
+func writeInput(w io.WriteCloser, cmds []string, input io.Reader, ready <-chan struct{}) {
+	go func() {
+		if ready != nil {
+			<-ready
+		}
+		for _, cmd := range cmds {
+			if _, err := io.WriteString(w, cmd+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+	io.Copy(w, input)
+	w.Close()
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSetEnv(t *testing.T) {
+	conf := `{"servers": [{"name": "web", "ip": "10.0.0.1", "options": {"SetEnv": {"APP_ENV": "prod", "_X1": "1", "A=1;rm -rf ~;B": "x", "1ABC": "y"}}}]}`
+	name := filepath.Join(t.TempDir(), "al.conf")
+	if err := ioutil.WriteFile(name, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := (&App{ConfigPath: name}).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		if strings.HasSuffix(p.Location, ".SetEnv") {
+			got = append(got, p.Message[strings.LastIndex(p.Message, "：")+len("："):])
+		}
+	}
+	if strings.Join(got, ",") != "1ABC,A=1;rm -rf ~;B" {
+		t.Fatalf("SetEnv problems = %q, all problems = %v", got, problems)
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// 键盘输入，只有一个goroutine读取os.Stdin，每次连接使用独立的reader，
+// 连接结束后旧的reader不再读取，避免重新连接时丢失输入
+type stdinPump struct {
+	once sync.Once
+	ch   chan []byte
+}
+
+var stdinInput = &stdinPump{ch: make(chan []byte)}
+
+func (p *stdinPump) start() {
+	p.once.Do(func() {
+		go func() {
+			for {
+				buf := make([]byte, 4096)
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					p.ch <- buf[:n]
+				}
+				if err != nil {
+					close(p.ch)
+					return
+				}
+			}
+		}()
+	})
+}
+
+// 创建reader，done关闭后返回io.EOF
+func (p *stdinPump) reader(done <-chan struct{}) io.Reader {
+	p.start()
+	return &pumpReader{p: p, done: done}
+}
+
+type pumpReader struct {
+	p    *stdinPump
+	done <-chan struct{}
+	rest []byte
+}
+
+func (r *pumpReader) Read(b []byte) (int, error) {
+	if len(r.rest) == 0 {
+		// 连接已结束时不再读取，输入留给下一次连接
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		default:
+		}
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		case c, ok := <-r.p.ch:
+			if !ok {
+				return 0, io.EOF
+			}
+			r.rest = c
+		}
+	}
+	n := copy(b, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
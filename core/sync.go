@@ -0,0 +1,584 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gssh/core/scp"
+)
+
+const (
+	//SyncFileName 同步文件默认名称
+	SyncFileName = "al.conf.sync"
+	//SyncRemotePath 远程同步文件默认路径（相对于用户目录）
+	SyncRemotePath = ".gssh/" + SyncFileName
+)
+
+// 同步文件格式，配置内容经过加密
+type syncFile struct {
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	Updated int64  `json:"updated"`
+	Host    string `json:"host"`
+	Data    string `json:"data"`
+}
+
+// 本地同步状态，记录上一次同步的版本，用于冲突检测和三方合并
+type syncState struct {
+	Hash    string `json:"hash"`
+	Updated int64  `json:"updated"`
+	Base    string `json:"base"`
+}
+
+//SyncTarget 配置同步目标，可以是服务器上的文件，也可以是本地目录（支持git仓库）
+type SyncTarget struct {
+	//Notify 接收同步过程的提示信息，为nil时不提示
+	Notify func(msg string)
+	app    *App
+	server *Server
+	path   string
+}
+
+//NewSyncTarget 解析同步目标
+//格式：服务器名[:路径] 或 本地目录/文件
+func NewSyncTarget(app *App, spec string) (*SyncTarget, error) {
+	if spec == "" {
+		return nil, errors.New("同步目标为空")
+	}
+
+	name, path := spec, ""
+	if i := strings.Index(spec, ":"); i > 0 {
+		name, path = spec[:i], spec[i+1:]
+	}
+	server, err := app.GetServer(name)
+	if err != nil && !errors.Is(err, ErrServerNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		path = strings.TrimPrefix(path, "~/")
+		if path == "" || path == "~" {
+			path = SyncRemotePath
+		} else if strings.HasSuffix(path, "/") {
+			path += SyncFileName
+		}
+		return &SyncTarget{app: app, server: server, path: path}, nil
+	}
+
+	path, err = ParsePath(spec)
+	if err != nil {
+		return nil, err
+	}
+	if !IsFile(path) && (IsExist(path) || strings.HasSuffix(spec, "/")) {
+		path = filepath.Join(path, SyncFileName)
+	}
+	return &SyncTarget{app: app, path: path}, nil
+}
+
+// 输出提示信息
+func (t *SyncTarget) notify(msg ...interface{}) {
+	if t.Notify != nil {
+		t.Notify(sprint(msg...))
+	}
+}
+
+//String 同步目标描述
+func (t *SyncTarget) String() string {
+	if t.server != nil {
+		return t.server.Name + ":" + t.path
+	}
+	return t.path
+}
+
+//Download 下载配置文件，本地和远程都有修改时进行三方合并
+func (t *SyncTarget) Download() error {
+	remote, err := t.read()
+	if err != nil {
+		return err
+	}
+	if remote == nil {
+		return errors.New("同步文件不存在：" + t.String())
+	}
+	remoteData, err := remote.decrypt()
+	if err != nil {
+		return err
+	}
+
+	local, err := ioutil.ReadFile(t.app.ConfigPath)
+	if err != nil {
+		return err
+	}
+	localHash := hashBytes(local)
+	state := t.loadState()
+
+	switch {
+	case remote.Hash == localHash:
+		t.notify("配置文件已是最新")
+	case state.Hash == localHash:
+		// 本地未修改，直接使用远程版本
+		if err := t.app.writeConfig(remoteData); err != nil {
+			return err
+		}
+		t.notify("配置文件已更新，远程版本时间：", formatUnix(remote.Updated))
+	case state.Hash == remote.Hash:
+		t.notify("远程配置未修改，本地修改尚未上传，请使用 -u 上传")
+		return nil
+	default:
+		t.notify("本地和远程配置均有修改，进行合并")
+		merged, err := t.merge(state, local, remoteData)
+		if err != nil {
+			return err
+		}
+		if err := t.app.writeConfig(merged); err != nil {
+			return err
+		}
+		t.notify("配置文件已合并，请使用 -u 上传合并结果")
+	}
+
+	return t.saveState(remote, remoteData)
+}
+
+//Upload 上传配置文件，远程在上次同步后有修改时先进行三方合并
+func (t *SyncTarget) Upload() error {
+	local, err := ioutil.ReadFile(t.app.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	remote, err := t.read()
+	if err != nil {
+		return err
+	}
+
+	if remote != nil {
+		state := t.loadState()
+		localHash := hashBytes(local)
+		if remote.Hash == localHash {
+			t.notify("远程配置已是最新")
+			return t.saveState(remote, local)
+		}
+		if remote.Hash != state.Hash {
+			t.notify("远程配置在上次同步后有修改（" + formatUnix(remote.Updated) + "，" + remote.Host + "），进行合并")
+			remoteData, err := remote.decrypt()
+			if err != nil {
+				return err
+			}
+			local, err = t.merge(state, local, remoteData)
+			if err != nil {
+				return err
+			}
+			if err := t.app.writeConfig(local); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := newSyncFile(local)
+	if err != nil {
+		return err
+	}
+	if err := t.write(f); err != nil {
+		return err
+	}
+	t.notify("配置文件已上传：", t.String())
+	return t.saveState(f, local)
+}
+
+func (t *SyncTarget) merge(state syncState, local, remote []byte) ([]byte, error) {
+	var base, l, r Config
+	if state.Base != "" {
+		b, err := Decrypt(state.Base)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(b), &base); err != nil {
+			return nil, errors.New("解析同步基线失败：" + err.Error())
+		}
+	}
+	if err := json.Unmarshal(local, &l); err != nil {
+		return nil, errors.New("解析本地配置失败：" + err.Error())
+	}
+	if err := json.Unmarshal(remote, &r); err != nil {
+		return nil, errors.New("解析远程配置失败：" + err.Error())
+	}
+
+	merged, conflicts := mergeConfig(base, l, r)
+	for _, c := range conflicts {
+		t.notify("冲突，保留本地版本：", c)
+	}
+	return marshalConfig(merged)
+}
+
+// 读取同步文件，不存在时返回nil
+func (t *SyncTarget) read() (*syncFile, error) {
+	var b []byte
+	if t.server != nil {
+		client, err := t.server.GenClient()
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		if _, err := NewRemoteFS(client).Stat(t.path); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		var buf bytes.Buffer
+		s := scp.NewSCP(client)
+		_, err = s.Receive(t.path, &buf)
+		AuditTransfer(t.server, "download", t.path, t.app.ConfigPath, s.Transferred(), err)
+		if err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	} else {
+		if !IsExist(t.path) {
+			return nil, nil
+		}
+		var err error
+		b, err = ioutil.ReadFile(t.path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := &syncFile{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, errors.New("同步文件格式错误：" + err.Error())
+	}
+	return f, nil
+}
+
+// 写入同步文件
+func (t *SyncTarget) write(f *syncFile) error {
+	b, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if t.server != nil {
+		client, err := t.server.GenClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := NewRemoteFS(client).MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+			return errors.New("创建远程目录失败：" + err.Error())
+		}
+
+		now := time.Now()
+		info := scp.NewFileInfo(t.path, int64(len(b)), 0600, now, now)
+		s := scp.NewSCP(client)
+		err = s.Send(info, ioutil.NopCloser(bytes.NewReader(b)), t.path)
+		AuditTransfer(t.server, "upload", t.app.ConfigPath, t.path, s.Transferred(), err)
+		return err
+	}
+
+	dir := filepath.Dir(t.path)
+	if err := EnsureDir(dir); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(t.path, b, 0600); err != nil {
+		return err
+	}
+	if IsExist(filepath.Join(dir, ".git")) {
+		return gitCommit(dir, filepath.Base(t.path), "gssh sync from "+f.Host)
+	}
+	return nil
+}
+
+// 本地状态文件和配置文件放在一起
+func (t *SyncTarget) statePath() string {
+	return t.app.ConfigPath + ".sync"
+}
+
+func (t *SyncTarget) loadState() syncState {
+	state := syncState{}
+	b, err := ioutil.ReadFile(t.statePath())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		Log.Error("parse sync state fail", err)
+	}
+	return state
+}
+
+func (t *SyncTarget) saveState(f *syncFile, data []byte) error {
+	base, err := Encrypt(string(data))
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(syncState{
+		Hash:    f.Hash,
+		Updated: f.Updated,
+		Base:    base,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(t.statePath(), b, 0600)
+}
+
+func newSyncFile(data []byte) (*syncFile, error) {
+	enc, err := Encrypt(string(data))
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &syncFile{
+		Version: 1,
+		Hash:    hashBytes(data),
+		Updated: time.Now().Unix(),
+		Host:    host,
+		Data:    enc,
+	}, nil
+}
+
+func (f *syncFile) decrypt() ([]byte, error) {
+	s, err := Decrypt(f.Data)
+	if err != nil {
+		return nil, errors.New("同步文件解密失败：" + err.Error())
+	}
+	if hashBytes([]byte(s)) != f.Hash {
+		return nil, errors.New("同步文件校验失败，请检查加密key是否一致")
+	}
+	return []byte(s), nil
+}
+
+// 写入配置文件（先备份）
+func (app *App) writeConfig(b []byte) error {
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return errors.New("配置文件格式错误：" + err.Error())
+	}
+	if err := app.backConfig(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(app.ConfigPath, b, os.ModePerm)
+}
+
+func gitCommit(dir, file, msg string) error {
+	out, err := exec.Command("git", "-C", dir, "add", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git add fail: %s", out)
+	}
+	// 没有变化时不提交
+	if exec.Command("git", "-C", dir, "diff", "--cached", "--quiet").Run() == nil {
+		return nil
+	}
+	out, err = exec.Command("git", "-C", dir, "commit", "-m", msg).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git commit fail: %s", out)
+	}
+	return nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func formatUnix(t int64) string {
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
+
+// 三方合并配置，冲突时保留本地版本
+func mergeConfig(base, local, remote Config) (Config, []string) {
+	merged := local
+	var conflicts []string
+
+	if local.ShowDetail == base.ShowDetail {
+		merged.ShowDetail = remote.ShowDetail
+	}
+
+	merged.Options, conflicts = mergeOptions("options", base.Options, local.Options, remote.Options)
+
+	servers, c := mergeServers("", base.Servers, local.Servers, remote.Servers)
+	merged.Servers = servers
+	conflicts = append(conflicts, c...)
+
+	groups, c := mergeGroups("", base.Groups, local.Groups, remote.Groups)
+	merged.Groups = groups
+	conflicts = append(conflicts, c...)
+
+	return merged, conflicts
+}
+
+// 合并单个条目，返回合并结果、是否保留以及是否冲突
+func mergeItem(b, l, r interface{}) (interface{}, bool, bool) {
+	bv, lv, rv := !isNil(b), !isNil(l), !isNil(r)
+	switch {
+	case !lv && !rv:
+		return nil, false, false
+	case lv && rv && reflect.DeepEqual(l, r):
+		return l, true, false
+	case reflect.DeepEqual(b, l) && bv == lv:
+		// 本地未修改，使用远程
+		return r, rv, false
+	case reflect.DeepEqual(b, r) && bv == rv:
+		// 远程未修改，使用本地
+		return l, lv, false
+	case !lv:
+		// 本地删除、远程修改，保留修改
+		return r, true, true
+	default:
+		return l, true, true
+	}
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func mergeOptions(name string, base, local, remote map[string]interface{}) (map[string]interface{}, []string) {
+	if base == nil && local == nil && remote == nil {
+		return nil, nil
+	}
+	merged := make(map[string]interface{})
+	var conflicts []string
+	for _, k := range mergeKeys(mapKeys(local), mapKeys(remote), mapKeys(base)) {
+		v, keep, conflict := mergeItem(base[k], local[k], remote[k])
+		if conflict {
+			conflicts = append(conflicts, name+"."+k)
+		}
+		if keep {
+			merged[k] = v
+		}
+	}
+	return merged, conflicts
+}
+
+func mergeServers(group string, base, local, remote []Server) ([]Server, []string) {
+	index := func(servers []Server) (map[string]*Server, []string) {
+		m := make(map[string]*Server)
+		var keys []string
+		for i := range servers {
+			m[servers[i].Name] = &servers[i]
+			keys = append(keys, servers[i].Name)
+		}
+		return m, keys
+	}
+	bm, bk := index(base)
+	lm, lk := index(local)
+	rm, rk := index(remote)
+
+	merged := []Server{}
+	var conflicts []string
+	for _, k := range mergeKeys(lk, rk, bk) {
+		v, keep, conflict := mergeItem(bm[k], lm[k], rm[k])
+		if conflict {
+			conflicts = append(conflicts, group+"server "+k)
+		}
+		if keep {
+			merged = append(merged, *v.(*Server))
+		}
+	}
+	return merged, conflicts
+}
+
+func mergeGroups(parent string, base, local, remote []Group) ([]Group, []string) {
+	index := func(groups []Group) (map[string]*Group, []string) {
+		m := make(map[string]*Group)
+		var keys []string
+		for i := range groups {
+			m[groups[i].Prefix] = &groups[i]
+			keys = append(keys, groups[i].Prefix)
+		}
+		return m, keys
+	}
+	bm, bk := index(base)
+	lm, lk := index(local)
+	rm, rk := index(remote)
+
+	// 分组自身的字段（不含服务和子分组）
+	header := func(g *Group) *Group {
+		if g == nil {
+			return nil
+		}
+		h := *g
+		h.Servers = nil
+		h.Groups = nil
+		return &h
+	}
+
+	merged := []Group{}
+	var conflicts []string
+	for _, k := range mergeKeys(lk, rk, bk) {
+		b, l, r := bm[k], lm[k], rm[k]
+		name := "group " + parent + k
+		switch {
+		case l != nil && r != nil:
+			// 两边都存在，分别合并分组字段、服务和子分组
+			var bh *Group
+			var bs []Server
+			var bg []Group
+			if b != nil {
+				bh, bs, bg = header(b), b.Servers, b.Groups
+			}
+			v, _, conflict := mergeItem(bh, header(l), header(r))
+			if conflict {
+				conflicts = append(conflicts, name)
+			}
+			g := *v.(*Group)
+			var c []string
+			g.Servers, c = mergeServers(name+" ", bs, l.Servers, r.Servers)
+			conflicts = append(conflicts, c...)
+			g.Groups, c = mergeGroups(parent+k, bg, l.Groups, r.Groups)
+			conflicts = append(conflicts, c...)
+			if len(g.Groups) == 0 {
+				g.Groups = nil
+			}
+			merged = append(merged, g)
+		default:
+			v, keep, conflict := mergeItem(b, l, r)
+			if conflict {
+				conflicts = append(conflicts, name)
+			}
+			if keep {
+				merged = append(merged, *v.(*Group))
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// 合并key列表，保持本地顺序，远程和基线新增的追加在后
+func mergeKeys(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, list := range lists {
+		for _, k := range list {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 用于比较合并结果，例如 web=10.0.0.1 p(admin)[db=10.0.1.1 c[cache=10.0.2.1]]，括号中为分组的user
+func describeServers(servers []Server, groups []Group) string {
+	var parts []string
+	for _, s := range servers {
+		parts = append(parts, s.Name+"="+s.IP)
+	}
+	for _, g := range groups {
+		user := ""
+		if g.User != "" {
+			user = "(" + g.User + ")"
+		}
+		parts = append(parts, g.Prefix+user+"["+describeServers(g.Servers, g.Groups)+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMergeItem(t *testing.T) {
+	tests := []struct {
+		name           string
+		b, l, r        interface{}
+		want           interface{}
+		keep, conflict bool
+	}{
+		{"unchanged", "a", "a", "a", "a", true, false},
+		{"changed locally", "a", "b", "a", "b", true, false},
+		{"changed remotely", "a", "a", "c", "c", true, false},
+		{"same change", "a", "b", "b", "b", true, false},
+		{"conflict", "a", "b", "c", "b", true, true},
+		{"added locally", nil, "b", nil, "b", true, false},
+		{"added remotely", nil, nil, "c", "c", true, false},
+		{"added on both sides", nil, "b", "c", "b", true, true},
+		{"deleted locally", "a", nil, "a", nil, false, false},
+		{"deleted remotely", "a", "a", nil, nil, false, false},
+		{"deleted on both sides", "a", nil, nil, nil, false, false},
+		{"deleted locally, edited remotely", "a", nil, "c", "c", true, true},
+		{"edited locally, deleted remotely", "a", "b", nil, "b", true, true},
+	}
+	for _, tt := range tests {
+		v, keep, conflict := mergeItem(tt.b, tt.l, tt.r)
+		if keep != tt.keep || conflict != tt.conflict || keep && !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("%s: mergeItem = %v, %v, %v, want %v, %v, %v", tt.name, v, keep, conflict, tt.want, tt.keep, tt.conflict)
+		}
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	server := func(name, ip string) Server {
+		return Server{Name: name, IP: ip}
+	}
+	base := Config{
+		Servers: []Server{server("web", "10.0.0.1"), server("api", "10.0.0.2")},
+		Groups: []Group{{
+			GroupName: "prod", Prefix: "p",
+			Servers: []Server{server("db", "10.0.1.1")},
+			Groups: []Group{{
+				GroupName: "child", Prefix: "c",
+				Servers: []Server{server("cache", "10.0.2.1"), server("mq", "10.0.2.2")},
+			}},
+		}},
+	}
+	// 复制基线后按需修改，避免各用例共用切片
+	edit := func(fn func(c *Config)) Config {
+		var c Config
+		b, _ := marshalConfig(base)
+		if err := json.Unmarshal(b, &c); err != nil {
+			t.Fatal(err)
+		}
+		if fn != nil {
+			fn(&c)
+		}
+		return c
+	}
+	child := func(c *Config) *Group {
+		return &c.Groups[0].Groups[0]
+	}
+
+	tests := []struct {
+		name          string
+		local, remote Config
+		want          string
+		conflicts     string
+	}{
+		{
+			name:   "unchanged",
+			local:  edit(nil),
+			remote: edit(nil),
+			want:   "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:   "changed only locally",
+			local:  edit(func(c *Config) { c.Servers[0].IP = "10.9.0.1" }),
+			remote: edit(nil),
+			want:   "web=10.9.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:   "changed only remotely",
+			local:  edit(nil),
+			remote: edit(func(c *Config) { c.Servers[1].IP = "10.8.0.2" }),
+			want:   "web=10.0.0.1 api=10.8.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:   "changed different servers on each side",
+			local:  edit(func(c *Config) { c.Servers[0].IP = "10.9.0.1" }),
+			remote: edit(func(c *Config) { c.Servers[1].IP = "10.8.0.2" }),
+			want:   "web=10.9.0.1 api=10.8.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:      "changed on both sides",
+			local:     edit(func(c *Config) { c.Servers[0].IP = "10.9.0.1" }),
+			remote:    edit(func(c *Config) { c.Servers[0].IP = "10.8.0.1" }),
+			want:      "web=10.9.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+			conflicts: "server web",
+		},
+		{
+			name:   "deleted on one side",
+			local:  edit(func(c *Config) { c.Servers = c.Servers[1:] }),
+			remote: edit(nil),
+			want:   "api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:      "deleted locally, edited remotely",
+			local:     edit(func(c *Config) { c.Servers = c.Servers[1:] }),
+			remote:    edit(func(c *Config) { c.Servers[0].IP = "10.8.0.1" }),
+			want:      "api=10.0.0.2 web=10.8.0.1 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+			conflicts: "server web",
+		},
+		{
+			name:      "edited locally, deleted remotely",
+			local:     edit(func(c *Config) { c.Servers[0].IP = "10.9.0.1" }),
+			remote:    edit(func(c *Config) { c.Servers = c.Servers[1:] }),
+			want:      "web=10.9.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+			conflicts: "server web",
+		},
+		{
+			name:   "added on each side",
+			local:  edit(func(c *Config) { c.Servers = append(c.Servers, server("new1", "10.0.0.3")) }),
+			remote: edit(func(c *Config) { c.Servers = append(c.Servers, server("new2", "10.0.0.4")) }),
+			want:   "web=10.0.0.1 api=10.0.0.2 new1=10.0.0.3 new2=10.0.0.4 p[db=10.0.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:   "nested servers changed on different sides",
+			local:  edit(func(c *Config) { child(c).Servers[0].IP = "10.9.2.1" }),
+			remote: edit(func(c *Config) { child(c).Servers[1].IP = "10.8.2.2" }),
+			want:   "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.9.2.1 mq=10.8.2.2]]",
+		},
+		{
+			name:      "nested server changed on both sides",
+			local:     edit(func(c *Config) { child(c).Servers[0].IP = "10.9.2.1" }),
+			remote:    edit(func(c *Config) { child(c).Servers[0].IP = "10.8.2.1" }),
+			want:      "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.9.2.1 mq=10.0.2.2]]",
+			conflicts: "group pc server cache",
+		},
+		{
+			name:   "nested server deleted remotely",
+			local:  edit(nil),
+			remote: edit(func(c *Config) { child(c).Servers = child(c).Servers[:1] }),
+			want:   "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.0.2.1]]",
+		},
+		{
+			name:      "nested server deleted locally, edited remotely",
+			local:     edit(func(c *Config) { child(c).Servers = child(c).Servers[1:] }),
+			remote:    edit(func(c *Config) { child(c).Servers[0].IP = "10.8.2.1" }),
+			want:      "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[mq=10.0.2.2 cache=10.8.2.1]]",
+			conflicts: "group pc server cache",
+		},
+		{
+			name:   "group changed locally, its servers remotely",
+			local:  edit(func(c *Config) { c.Groups[0].User = "admin" }),
+			remote: edit(func(c *Config) { c.Groups[0].Servers[0].IP = "10.8.1.1" }),
+			want:   "web=10.0.0.1 api=10.0.0.2 p(admin)[db=10.8.1.1 c[cache=10.0.2.1 mq=10.0.2.2]]",
+		},
+		{
+			name:      "group deleted locally, nested server edited remotely",
+			local:     edit(func(c *Config) { c.Groups = nil }),
+			remote:    edit(func(c *Config) { child(c).Servers[0].IP = "10.8.2.1" }),
+			want:      "web=10.0.0.1 api=10.0.0.2 p[db=10.0.1.1 c[cache=10.8.2.1 mq=10.0.2.2]]",
+			conflicts: "group p",
+		},
+	}
+	for _, tt := range tests {
+		merged, conflicts := mergeConfig(edit(nil), tt.local, tt.remote)
+		if got := describeServers(merged.Servers, merged.Groups); got != tt.want {
+			t.Errorf("%s: merged %s, want %s", tt.name, got, tt.want)
+		}
+		if got := strings.Join(conflicts, ","); got != tt.conflicts {
+			t.Errorf("%s: conflicts %q, want %q", tt.name, got, tt.conflicts)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 默认转发的本地环境变量，同ssh默认配置的 SendEnv LANG LC_*
+var defaultSendEnv = []string{"LANG", "LC_*"}
+
+// TerminalModes中可以使用的名称
+var terminalModeNames = map[string]uint8{
+	"VINTR": ssh.VINTR, "VQUIT": ssh.VQUIT, "VERASE": ssh.VERASE, "VKILL": ssh.VKILL,
+	"VEOF": ssh.VEOF, "VEOL": ssh.VEOL, "VEOL2": ssh.VEOL2, "VSTART": ssh.VSTART,
+	"VSTOP": ssh.VSTOP, "VSUSP": ssh.VSUSP, "VDSUSP": ssh.VDSUSP, "VREPRINT": ssh.VREPRINT,
+	"VWERASE": ssh.VWERASE, "VLNEXT": ssh.VLNEXT, "VFLUSH": ssh.VFLUSH, "VSWTCH": ssh.VSWTCH,
+	"VSTATUS": ssh.VSTATUS, "VDISCARD": ssh.VDISCARD,
+	"IGNPAR": ssh.IGNPAR, "PARMRK": ssh.PARMRK, "INPCK": ssh.INPCK, "ISTRIP": ssh.ISTRIP,
+	"INLCR": ssh.INLCR, "IGNCR": ssh.IGNCR, "ICRNL": ssh.ICRNL, "IUCLC": ssh.IUCLC,
+	"IXON": ssh.IXON, "IXANY": ssh.IXANY, "IXOFF": ssh.IXOFF, "IMAXBEL": ssh.IMAXBEL,
+	"IUTF8": 42,
+	"ISIG": ssh.ISIG, "ICANON": ssh.ICANON, "XCASE": ssh.XCASE, "ECHO": ssh.ECHO,
+	"ECHOE": ssh.ECHOE, "ECHOK": ssh.ECHOK, "ECHONL": ssh.ECHONL, "NOFLSH": ssh.NOFLSH,
+	"TOSTOP": ssh.TOSTOP, "IEXTEN": ssh.IEXTEN, "ECHOCTL": ssh.ECHOCTL, "ECHOKE": ssh.ECHOKE,
+	"PENDIN": ssh.PENDIN,
+	"OPOST": ssh.OPOST, "OLCUC": ssh.OLCUC, "ONLCR": ssh.ONLCR, "OCRNL": ssh.OCRNL,
+	"ONOCR": ssh.ONOCR, "ONLRET": ssh.ONLRET,
+	"CS7": ssh.CS7, "CS8": ssh.CS8, "PARENB": ssh.PARENB, "PARODD": ssh.PARODD,
+	"TTY_OP_ISPEED": ssh.TTY_OP_ISPEED, "TTY_OP_OSPEED": ssh.TTY_OP_OSPEED,
+}
+
+// 终端类型：Term选项，默认使用本地的$TERM
+func (server *Server) termType() string {
+	if t, _ := server.Options["Term"].(string); t != "" {
+		return t
+	}
+	if t := os.Getenv("TERM"); t != "" && t != "dumb" {
+		return t
+	}
+	return "xterm-256color"
+}
+
+// 终端模式：默认值加上TerminalModes选项，例如 {"ECHO": 1, "IUTF8": 1}
+func (server *Server) terminalModes() ssh.TerminalModes {
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	m, _ := server.Options["TerminalModes"].(map[string]interface{})
+	for name, v := range m {
+		op, ok := terminalModeNames[strings.ToUpper(name)]
+		n, isNumber := v.(float64)
+		if !ok || !isNumber {
+			Log.Error("unknown terminal mode", name, v)
+			continue
+		}
+		modes[op] = uint32(n)
+	}
+	return modes
+}
+
+// 检查TerminalModes选项
+func checkTerminalModes(v interface{}) []string {
+	m, _ := v.(map[string]interface{})
+	var problems []string
+	for name, value := range m {
+		if _, ok := terminalModeNames[strings.ToUpper(name)]; !ok {
+			problems = append(problems, "未知的终端模式："+name)
+		} else if _, ok := value.(float64); !ok {
+			problems = append(problems, "终端模式的值应为数字："+name)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// 转发本地环境变量：LANG、LC_*以及SendEnv选项中的名称（支持通配符）
+func (server *Server) sendEnv(session *ssh.Session) {
+	patterns := defaultSendEnv
+	list, _ := server.Options["SendEnv"].([]interface{})
+	for _, item := range list {
+		if p, ok := item.(string); ok && p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+		name := kv[:i]
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				if err := session.Setenv(name, kv[i+1:]); err != nil {
+					Log.Debug("setenv rejected", name)
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package tui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+//CopyToClipboard 复制到剪贴板，优先使用系统命令，失败时使用OSC 52终端序列（支持ssh远程终端）
+func CopyToClipboard(text string) error {
+	var cmds [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		cmds = [][]string{{"pbcopy"}}
+	case "windows":
+		cmds = [][]string{{"clip"}}
+	default:
+		cmds = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	}
+	for _, c := range cmds {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err == nil {
+			return nil
+		}
+	}
+
+	_, err := fmt.Fprintf(os.Stdout, "\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
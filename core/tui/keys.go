@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+//KeyCode 按键类型
+type KeyCode int
+
+//KeyCode 枚举类型
+const (
+	KeyRune KeyCode = iota
+	KeyEnter
+	KeyEsc
+	KeyTab
+	KeyBackspace
+	KeyDelete
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPgUp
+	KeyPgDn
+	KeyCtrl
+	KeyF
+	KeyUnknown
+)
+
+//Key 按键，KeyRune时Rune为字符，KeyCtrl时Rune为对应的小写字母，KeyF时Rune为功能键序号
+type Key struct {
+	Code KeyCode
+	Rune rune
+}
+
+//Ctrl 构造Ctrl组合键
+func Ctrl(r rune) Key {
+	return Key{Code: KeyCtrl, Rune: unicode.ToLower(r)}
+}
+
+// 解析按键，返回按键和使用的字节数
+func parseKey(b []byte) (Key, int) {
+	switch b[0] {
+	case '\r', '\n':
+		return Key{Code: KeyEnter}, 1
+	case '\t':
+		return Key{Code: KeyTab}, 1
+	case 0x7f, 0x08:
+		return Key{Code: KeyBackspace}, 1
+	case 0x1b:
+		return parseEscape(b)
+	}
+	if b[0] < 0x20 {
+		return Key{Code: KeyCtrl, Rune: rune(b[0]) + 'a' - 1}, 1
+	}
+	r, n := utf8.DecodeRune(b)
+	return Key{Code: KeyRune, Rune: r}, n
+}
+
+var escapes = map[string]Key{
+	"[A":   {Code: KeyUp},
+	"[B":   {Code: KeyDown},
+	"[C":   {Code: KeyRight},
+	"[D":   {Code: KeyLeft},
+	"[H":   {Code: KeyHome},
+	"[F":   {Code: KeyEnd},
+	"OA":   {Code: KeyUp},
+	"OB":   {Code: KeyDown},
+	"OC":   {Code: KeyRight},
+	"OD":   {Code: KeyLeft},
+	"OH":   {Code: KeyHome},
+	"OF":   {Code: KeyEnd},
+	"OP":   {Code: KeyF, Rune: 1},
+	"OQ":   {Code: KeyF, Rune: 2},
+	"OR":   {Code: KeyF, Rune: 3},
+	"OS":   {Code: KeyF, Rune: 4},
+	"[1~":  {Code: KeyHome},
+	"[3~":  {Code: KeyDelete},
+	"[4~":  {Code: KeyEnd},
+	"[5~":  {Code: KeyPgUp},
+	"[6~":  {Code: KeyPgDn},
+	"[7~":  {Code: KeyHome},
+	"[8~":  {Code: KeyEnd},
+	"[15~": {Code: KeyF, Rune: 5},
+	"[17~": {Code: KeyF, Rune: 6},
+	"[18~": {Code: KeyF, Rune: 7},
+	"[19~": {Code: KeyF, Rune: 8},
+	"[20~": {Code: KeyF, Rune: 9},
+	"[21~": {Code: KeyF, Rune: 10},
+}
+
+func parseEscape(b []byte) (Key, int) {
+	if len(b) == 1 {
+		return Key{Code: KeyEsc}, 1
+	}
+	if b[1] != '[' && b[1] != 'O' {
+		// Alt+字符按Esc处理
+		return Key{Code: KeyEsc}, 1
+	}
+	// 序列以字母或~结束
+	for i := 2; i < len(b) && i < 8; i++ {
+		c := b[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c == '~' {
+			if key, ok := escapes[string(b[1:i+1])]; ok {
+				return key, i + 1
+			}
+			return Key{Code: KeyUnknown}, i + 1
+		}
+	}
+	return Key{Code: KeyEsc}, 1
+}
@@ -0,0 +1,344 @@
+package tui
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Item 选择项
+type Item struct {
+	Section string
+	Key     string
+	Label   string
+	Detail  string
+	// 参与模糊匹配的文本，为空时使用Key、Label和Detail
+	Search string
+}
+
+//Action 选中后可执行的操作
+type Action struct {
+	Key  Key
+	Name string
+	Help string
+}
+
+//Result 选择结果，Action为空表示退出
+type Result struct {
+	Action string
+	Item   int
+}
+
+// 列表中的一行，item为-1表示分组标题
+type pickerRow struct {
+	section string
+	item    int
+	count   int
+}
+
+//Picker 全屏模糊搜索选择器，支持分组折叠
+type Picker struct {
+	Title   string
+	Items   []Item
+	Actions []Action
+	Status  string
+
+	query     []rune
+	cursor    int
+	offset    int
+	collapsed map[string]bool
+	rows      []pickerRow
+	// 上次Run结束时光标所在的行，再次Run时恢复
+	mark *pickerMark
+}
+
+// 光标所在行的标识，Items在两次Run之间可能被修改，所以不使用下标
+type pickerMark struct {
+	section string
+	key     string
+	header  bool
+}
+
+//NewPicker 创建选择器，回车对应第一个操作
+func NewPicker(title string, items []Item, actions []Action) *Picker {
+	return &Picker{
+		Title:     title,
+		Items:     items,
+		Actions:   actions,
+		collapsed: make(map[string]bool),
+	}
+}
+
+//Run 显示选择器直到选中或退出，可重复调用，搜索条件和光标位置会保留
+func (p *Picker) Run(t *Terminal) (Result, error) {
+	p.restore()
+	defer p.save()
+	for {
+		p.render(t)
+		key, err := t.ReadKey()
+		if err != nil {
+			return Result{Item: -1}, err
+		}
+		p.Status = ""
+
+		if action, ok := p.action(key); ok {
+			row := p.current()
+			if row == nil {
+				continue
+			}
+			if row.item < 0 {
+				if key.Code == KeyEnter {
+					p.toggle(row.section)
+				}
+				continue
+			}
+			return Result{Action: action, Item: row.item}, nil
+		}
+
+		_, h := t.Size()
+		page := h - 5
+		switch key.Code {
+		case KeyEsc:
+			return Result{Item: -1}, nil
+		case KeyCtrl:
+			if key.Rune == 'c' || key.Rune == 'd' {
+				return Result{Item: -1}, nil
+			}
+			if key.Rune == 'u' {
+				p.query = p.query[:0]
+				p.filter()
+			}
+			if key.Rune == 'p' {
+				p.move(-1)
+			}
+			if key.Rune == 'n' {
+				p.move(1)
+			}
+		case KeyUp:
+			p.move(-1)
+		case KeyDown:
+			p.move(1)
+		case KeyPgUp:
+			p.move(-page)
+		case KeyPgDn:
+			p.move(page)
+		case KeyHome:
+			p.cursor = 0
+		case KeyEnd:
+			p.cursor = len(p.rows) - 1
+		case KeyTab:
+			if row := p.current(); row != nil {
+				p.toggle(row.section)
+			}
+		case KeyLeft:
+			if row := p.current(); row != nil && !p.collapsed[row.section] {
+				p.toggle(row.section)
+			}
+		case KeyRight:
+			if row := p.current(); row != nil && p.collapsed[row.section] {
+				p.toggle(row.section)
+			}
+		case KeyBackspace:
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case KeyRune:
+			p.query = append(p.query, key.Rune)
+			p.filter()
+		}
+	}
+}
+
+func (p *Picker) action(key Key) (string, bool) {
+	for _, a := range p.Actions {
+		if a.Key == key {
+			return a.Name, true
+		}
+	}
+	return "", false
+}
+
+func (p *Picker) current() *pickerRow {
+	if p.cursor < 0 || p.cursor >= len(p.rows) {
+		return nil
+	}
+	return &p.rows[p.cursor]
+}
+
+func (p *Picker) move(n int) {
+	p.cursor += n
+	if p.cursor >= len(p.rows) {
+		p.cursor = len(p.rows) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// 折叠/展开分组，光标停留在分组标题
+func (p *Picker) toggle(section string) {
+	p.collapsed[section] = !p.collapsed[section]
+	p.build()
+	for i, row := range p.rows {
+		if row.item < 0 && row.section == section {
+			p.cursor = i
+			return
+		}
+	}
+}
+
+// 记录光标所在的行
+func (p *Picker) save() {
+	row := p.current()
+	if row == nil {
+		p.mark = nil
+		return
+	}
+	p.mark = &pickerMark{section: row.section, header: row.item < 0}
+	if row.item >= 0 {
+		p.mark.key = p.Items[row.item].Key
+	}
+}
+
+// 重新生成列表，光标回到上次Run结束时的行，找不到时和搜索一样移动到第一个匹配项
+func (p *Picker) restore() {
+	if p.mark == nil {
+		p.filter()
+		return
+	}
+	p.build()
+	for i, row := range p.rows {
+		if row.section != p.mark.section || (row.item < 0) != p.mark.header {
+			continue
+		}
+		if row.item < 0 || p.Items[row.item].Key == p.mark.key {
+			p.cursor = i
+			return
+		}
+	}
+	p.filter()
+}
+
+// 搜索条件变化后重新过滤，光标移动到第一个匹配项
+func (p *Picker) filter() {
+	p.build()
+	p.cursor = 0
+	for i, row := range p.rows {
+		if row.item >= 0 {
+			p.cursor = i
+			return
+		}
+	}
+}
+
+// 生成列表行，搜索时展开所有分组并按得分排序
+func (p *Picker) build() {
+	query := string(p.query)
+	type match struct {
+		item  int
+		score int
+	}
+	var sections []string
+	matches := make(map[string][]match)
+	for i, item := range p.Items {
+		text := item.Search
+		if text == "" {
+			text = item.Key + " " + item.Label + " " + item.Detail
+		}
+		score, ok := FuzzyMatch(query, text)
+		if !ok {
+			continue
+		}
+		if _, ok := matches[item.Section]; !ok {
+			sections = append(sections, item.Section)
+		}
+		matches[item.Section] = append(matches[item.Section], match{item: i, score: score})
+	}
+
+	p.rows = p.rows[:0]
+	for _, section := range sections {
+		ms := matches[section]
+		if query != "" {
+			sort.SliceStable(ms, func(i, j int) bool { return ms[i].score > ms[j].score })
+		}
+		p.rows = append(p.rows, pickerRow{section: section, item: -1, count: len(ms)})
+		if p.collapsed[section] && query == "" {
+			continue
+		}
+		for _, m := range ms {
+			p.rows = append(p.rows, pickerRow{section: section, item: m.item})
+		}
+	}
+	if p.cursor >= len(p.rows) {
+		p.cursor = len(p.rows) - 1
+	}
+}
+
+func (p *Picker) render(t *Terminal) {
+	w, h := t.Size()
+	listHeight := h - 5
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+listHeight {
+		p.offset = p.cursor - listHeight + 1
+	}
+	if p.offset < 0 {
+		p.offset = 0
+	}
+
+	keyWidth, labelWidth := 0, 0
+	for _, item := range p.Items {
+		if n := Width(item.Key); n > keyWidth {
+			keyWidth = n
+		}
+		if n := Width(item.Label); n > labelWidth {
+			labelWidth = n
+		}
+	}
+
+	t.Clear()
+	t.Line(0, " "+p.Title, "1;32")
+	t.Line(2, strings.Repeat("─", w), "")
+	for i := 0; i < listHeight; i++ {
+		n := p.offset + i
+		if n >= len(p.rows) {
+			break
+		}
+		row := p.rows[n]
+		style := ""
+		if n == p.cursor {
+			style = "7"
+		}
+		if row.item < 0 {
+			mark := "▾"
+			if p.collapsed[row.section] && len(p.query) == 0 {
+				mark = "▸"
+			}
+			if style == "" {
+				style = "1;36"
+			}
+			t.Line(3+i, mark+" "+row.section+" ("+strconv.Itoa(row.count)+")", style)
+			continue
+		}
+		item := p.Items[row.item]
+		t.Line(3+i, "   ["+Pad(item.Key, keyWidth)+"] "+Pad(item.Label, labelWidth)+"  "+item.Detail, style)
+	}
+
+	var help []string
+	for _, a := range p.Actions {
+		help = append(help, a.Help)
+	}
+	help = append(help, "Tab 折叠", "Esc 退出")
+	t.Line(h-2, p.Status, "33")
+	t.Line(h-1, strings.Join(help, "  "), "2")
+
+	prompt := "> " + string(p.query)
+	t.Line(1, prompt, "")
+	t.ShowCursor(1, Width(prompt))
+	t.Flush()
+}
@@ -0,0 +1,40 @@
+package tui
+
+import "testing"
+
+func TestPickerKeepsCursor(t *testing.T) {
+	items := []Item{
+		{Section: "web", Key: "1", Label: "web1"},
+		{Section: "web", Key: "2", Label: "web2"},
+		{Section: "db", Key: "3", Label: "db1"},
+	}
+	p := NewPicker("test", items, nil)
+	p.restore()
+	if row := p.current(); row == nil || row.item != 0 {
+		t.Fatalf("first run cursor on %+v, want item 0", row)
+	}
+
+	// 复制等操作后再次Run，光标不变
+	p.move(3)
+	p.save()
+	p.restore()
+	if row := p.current(); row == nil || row.item != 2 {
+		t.Fatalf("cursor on %+v after reopening, want item 2", row)
+	}
+
+	// 选择项被修改后按Key找到原来的项
+	p.save()
+	p.Items = append([]Item{{Section: "db", Key: "0", Label: "db0"}}, items...)
+	p.restore()
+	if row := p.current(); row == nil || p.Items[row.item].Key != "3" {
+		t.Fatalf("cursor on %+v after items changed, want key 3", row)
+	}
+
+	// 原来的项不存在时移动到第一个匹配项
+	p.save()
+	p.Items = items[:2]
+	p.restore()
+	if row := p.current(); row == nil || row.item != 0 {
+		t.Fatalf("cursor on %+v after item removed, want item 0", row)
+	}
+}
@@ -0,0 +1,148 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+//IsTerminal 标准输入输出是否都是终端
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+//Terminal 全屏终端，进入时切换到备用屏幕并开启raw模式
+type Terminal struct {
+	fd       int
+	oldState *term.State
+	in       io.Reader
+	out      *bufio.Writer
+	pending  []byte
+}
+
+//Open 打开全屏终端，使用完需要调用Close恢复
+func Open() (*Terminal, error) {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := &Terminal{
+		fd:       fd,
+		oldState: oldState,
+		in:       os.Stdin,
+		out:      bufio.NewWriterSize(os.Stdout, 64*1024),
+	}
+	// 备用屏幕、隐藏光标
+	t.out.WriteString("\033[?1049h\033[?25l")
+	t.out.Flush()
+	return t, nil
+}
+
+//Close 恢复终端
+func (t *Terminal) Close() error {
+	t.out.WriteString("\033[0m\033[?25h\033[?1049l")
+	t.out.Flush()
+	return term.Restore(t.fd, t.oldState)
+}
+
+//Suspend 暂时恢复普通终端（例如执行行模式的编辑），返回的函数用于重新进入
+func (t *Terminal) Suspend() (func() error, error) {
+	if err := t.Close(); err != nil {
+		return nil, err
+	}
+	return func() error {
+		oldState, err := term.MakeRaw(t.fd)
+		if err != nil {
+			return err
+		}
+		t.oldState = oldState
+		t.out.WriteString("\033[?1049h\033[?25l")
+		return t.out.Flush()
+	}, nil
+}
+
+//Size 终端宽高
+func (t *Terminal) Size() (int, int) {
+	w, h, err := term.GetSize(t.fd)
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+//Clear 清屏并移动到左上角
+func (t *Terminal) Clear() {
+	t.out.WriteString("\033[H\033[2J")
+}
+
+//MoveTo 移动光标，行列从0开始
+func (t *Terminal) MoveTo(row, col int) {
+	fmt.Fprintf(t.out, "\033[%d;%dH", row+1, col+1)
+}
+
+//Line 在指定行输出内容，超出宽度时截断，style为SGR参数（例如"7"反显），可为空
+func (t *Terminal) Line(row int, text, style string) {
+	w, _ := t.Size()
+	t.MoveTo(row, 0)
+	t.out.WriteString("\033[2K")
+	if style != "" {
+		t.out.WriteString("\033[" + style + "m")
+	}
+	text = Truncate(text, w)
+	t.out.WriteString(text)
+	if style != "" {
+		// 反显时填满整行
+		if pad := w - Width(text); pad > 0 {
+			t.out.WriteString(strings.Repeat(" ", pad))
+		}
+		t.out.WriteString("\033[0m")
+	}
+}
+
+//Text 在指定位置输出内容，不清除该行的其他内容，style为SGR参数，可为空
+func (t *Terminal) Text(row, col int, text, style string) {
+	t.MoveTo(row, col)
+	if style != "" {
+		t.out.WriteString("\033[" + style + "m")
+	}
+	t.out.WriteString(text)
+	if style != "" {
+		t.out.WriteString("\033[0m")
+	}
+}
+
+//ShowCursor 在指定位置显示光标
+func (t *Terminal) ShowCursor(row, col int) {
+	t.MoveTo(row, col)
+	t.out.WriteString("\033[?25h")
+}
+
+//HideCursor 隐藏光标
+func (t *Terminal) HideCursor() {
+	t.out.WriteString("\033[?25l")
+}
+
+//Flush 输出缓存
+func (t *Terminal) Flush() error {
+	return t.out.Flush()
+}
+
+//ReadKey 读取一个按键
+func (t *Terminal) ReadKey() (Key, error) {
+	if len(t.pending) == 0 {
+		buf := make([]byte, 256)
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return Key{}, err
+		}
+		t.pending = buf[:n]
+	}
+	key, n := parseKey(t.pending)
+	t.pending = t.pending[n:]
+	return key, nil
+}
@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 宽字符（中日韩）占两列
+func runeWidth(r rune) int {
+	if r < 0x1100 {
+		return 1
+	}
+	if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r) ||
+		unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		(r >= 0xff00 && r <= 0xff60) || (r >= 0x3000 && r <= 0x303f) {
+		return 2
+	}
+	return 1
+}
+
+//Width 字符串显示宽度
+func Width(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+//Truncate 按显示宽度截断
+func Truncate(s string, width int) string {
+	w := 0
+	for i, r := range s {
+		w += runeWidth(r)
+		if w > width {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+//Pad 按显示宽度右侧补空格
+func Pad(s string, width int) string {
+	s = Truncate(s, width)
+	if w := Width(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+//FuzzyMatch 模糊匹配（按顺序包含pattern的所有字符，不区分大小写），返回匹配得分
+func FuzzyMatch(pattern, text string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(text))
+
+	score, pi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			// 连续匹配
+			score += 5
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			// 单词开头
+			score += 3
+		}
+		prev = ti
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	if strings.Contains(string(t), string(p)) {
+		score += 10
+	}
+	return score, true
+}
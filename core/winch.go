@@ -0,0 +1,34 @@
+// +build !windows
+
+package core
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 窗口大小变化通知，unix下使用SIGWINCH信号
+func windowChanges() (<-chan struct{}, func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+	ch := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sig:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, func() {
+		signal.Stop(sig)
+		close(stop)
+	}
+}
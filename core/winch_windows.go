@@ -0,0 +1,29 @@
+// +build windows
+
+package core
+
+import "time"
+
+// 窗口大小变化通知，windows没有SIGWINCH，定时检查
+func windowChanges() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, func() {
+		ticker.Stop()
+		close(stop)
+	}
+}
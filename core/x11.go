@@ -0,0 +1,224 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// x11-req请求，见RFC 4254 6.3.1
+type x11Request struct {
+	SingleConnection bool
+	AuthProtocol     string
+	AuthCookie       string
+	ScreenNumber     uint32
+}
+
+// X11认证协议，只支持MIT-MAGIC-COOKIE-1
+const x11AuthProto = "MIT-MAGIC-COOKIE-1"
+
+// X11转发的认证：和OpenSSH一样只把随机的假cookie发给远程，
+// 远程程序连接时检查假cookie，再换成本地X服务的真cookie，真cookie不离开本机
+type x11Auth struct {
+	fake []byte
+	// 本地X服务的cookie，xauth读取失败时为nil，连接本地X服务时不带认证
+	real []byte
+}
+
+// 转发X11（ForwardX11），远程的图形程序显示在本地的DISPLAY
+func (server *Server) forwardX11(client *ssh.Client, session *ssh.Session) {
+	if on, _ := server.Options["ForwardX11"].(bool); !on {
+		return
+	}
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		Log.Error("ForwardX11: DISPLAY not set")
+		return
+	}
+	network, addr, screen, err := parseDisplay(display)
+	if err != nil {
+		Log.Error("ForwardX11", err)
+		return
+	}
+
+	auth := &x11Auth{real: xauthCookie(display)}
+	auth.fake = make([]byte, 16)
+	if len(auth.real) > 0 {
+		auth.fake = make([]byte, len(auth.real))
+	}
+	if _, err := rand.Read(auth.fake); err != nil {
+		Log.Error("ForwardX11", err)
+		return
+	}
+
+	channels := client.HandleChannelOpen("x11")
+	if channels == nil {
+		Log.Error("ForwardX11: x11 channel already handled")
+		return
+	}
+	go func() {
+		for ch := range channels {
+			go proxyX11(ch, network, addr, auth)
+		}
+	}()
+
+	req := x11Request{
+		AuthProtocol: x11AuthProto,
+		AuthCookie:   hex.EncodeToString(auth.fake),
+		ScreenNumber: screen,
+	}
+	ok, err := session.SendRequest("x11-req", true, ssh.Marshal(&req))
+	if err != nil || !ok {
+		Log.Error("request x11 forwarding fail", err)
+	}
+}
+
+func proxyX11(ch ssh.NewChannel, network, addr string, auth *x11Auth) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		Log.Error("ForwardX11 dial display fail", err)
+		ch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := ch.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	// 连接建立请求在通道的数据中，检查并替换cookie后才发给本地X服务，不匹配时关闭通道
+	setup, err := auth.rewriteSetup(channel)
+	if err == nil {
+		_, err = conn.Write(setup)
+	}
+	if err != nil {
+		Log.Error("ForwardX11 reject connection", err)
+		channel.Close()
+		conn.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, channel)
+		if c, ok := conn.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	channel.Close()
+	conn.Close()
+}
+
+// 解析DISPLAY，返回本地X服务的地址和屏幕号
+// :0、unix:0 为/tmp/.X11-unix/X0，host:10.0 为tcp host:6010，/path/socket:0 为unix socket（macOS）
+func parseDisplay(display string) (network, addr string, screen uint32, err error) {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return "", "", 0, errors.New("DISPLAY格式错误：" + display)
+	}
+	host, num := display[:i], display[i+1:]
+	if j := strings.Index(num, "."); j >= 0 {
+		s, err := strconv.Atoi(num[j+1:])
+		if err != nil {
+			return "", "", 0, errors.New("DISPLAY格式错误：" + display)
+		}
+		screen = uint32(s)
+		num = num[:j]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return "", "", 0, errors.New("DISPLAY格式错误：" + display)
+	}
+
+	switch {
+	case strings.HasPrefix(host, "/"):
+		return "unix", display, screen, nil
+	case host == "" || host == "unix":
+		return "unix", "/tmp/.X11-unix/X" + num, screen, nil
+	default:
+		return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), screen, nil
+	}
+}
+
+// 使用xauth读取本地的cookie，读取失败时返回nil
+func xauthCookie(display string) []byte {
+	out, err := exec.Command("xauth", "list", display).Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[1] == x11AuthProto {
+				if cookie, err := hex.DecodeString(fields[2]); err == nil {
+					return cookie
+				}
+			}
+		}
+	}
+	Log.Info("ForwardX11: xauth cookie not found, connect display without auth")
+	return nil
+}
+
+// 读取X11连接建立请求，检查其中的假cookie，返回换成真cookie的请求
+// 请求格式：字节序（B或l）、1字节未用、主次版本号、认证协议名长度、认证数据长度、2字节未用，
+// 之后是认证协议名和认证数据，都补齐到4字节
+func (auth *x11Auth) rewriteSetup(r io.Reader) ([]byte, error) {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch head[0] {
+	case 'B':
+		order = binary.BigEndian
+	case 'l':
+		order = binary.LittleEndian
+	default:
+		return nil, errors.New("X11连接请求格式错误")
+	}
+	nameLen, dataLen := int(order.Uint16(head[6:])), int(order.Uint16(head[8:]))
+	body := make([]byte, pad4(nameLen)+pad4(dataLen))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	name, data := body[:nameLen], body[pad4(nameLen):pad4(nameLen)+dataLen]
+	if string(name) != x11AuthProto || subtle.ConstantTimeCompare(data, auth.fake) != 1 {
+		return nil, errors.New("X11 cookie不匹配")
+	}
+
+	proto, cookie := x11AuthProto, auth.real
+	if cookie == nil {
+		proto = ""
+	}
+	setup := make([]byte, 12, 12+pad4(len(proto))+pad4(len(cookie)))
+	copy(setup, head)
+	order.PutUint16(setup[6:], uint16(len(proto)))
+	order.PutUint16(setup[8:], uint16(len(cookie)))
+	setup = append(setup, make([]byte, pad4(len(proto)))...)
+	copy(setup[12:], proto)
+	setup = append(setup, make([]byte, pad4(len(cookie)))...)
+	copy(setup[12+pad4(len(proto)):], cookie)
+	return setup, nil
+}
+
+// 补齐到4的倍数
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
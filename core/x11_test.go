@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// 按字节序生成X11连接建立请求
+func x11Setup(order binary.ByteOrder, proto string, cookie []byte) []byte {
+	b := []byte{'l', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if order == binary.BigEndian {
+		b[0] = 'B'
+	}
+	order.PutUint16(b[2:], 11)
+	order.PutUint16(b[6:], uint16(len(proto)))
+	order.PutUint16(b[8:], uint16(len(cookie)))
+	b = append(b, proto...)
+	b = append(b, make([]byte, pad4(len(proto))-len(proto))...)
+	b = append(b, cookie...)
+	return append(b, make([]byte, pad4(len(cookie))-len(cookie))...)
+}
+
+func TestX11RewriteSetup(t *testing.T) {
+	fake := []byte("0123456789abcdef")
+	real := []byte("fedcba9876543210")
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		auth := &x11Auth{fake: fake, real: real}
+		setup, err := auth.rewriteSetup(bytes.NewReader(x11Setup(order, x11AuthProto, fake)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := x11Setup(order, x11AuthProto, real); !bytes.Equal(setup, want) {
+			t.Errorf("%v: setup = %q, want %q", order, setup, want)
+		}
+
+		// 没有本地cookie时不带认证
+		auth.real = nil
+		setup, err = auth.rewriteSetup(bytes.NewReader(x11Setup(order, x11AuthProto, fake)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := x11Setup(order, "", nil); !bytes.Equal(setup, want) {
+			t.Errorf("%v: setup without cookie = %q, want %q", order, setup, want)
+		}
+	}
+
+	auth := &x11Auth{fake: fake, real: real}
+	for _, setup := range [][]byte{
+		x11Setup(binary.BigEndian, x11AuthProto, real),
+		x11Setup(binary.BigEndian, "XDM-AUTHORIZATION-1", fake),
+		x11Setup(binary.BigEndian, "", nil),
+		[]byte("x"),
+	} {
+		if _, err := auth.rewriteSetup(bytes.NewReader(setup)); err == nil {
+			t.Errorf("rewriteSetup(%q) succeeded", setup)
+		}
+	}
+}